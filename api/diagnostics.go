@@ -0,0 +1,40 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/api/rest"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/daemon"
+)
+
+// NewDiagnosticsUploader returns an uploader which sends collector diagnostics to the server
+func NewDiagnosticsUploader(httpClient *http.Client, ctx *context.Ctx) daemon.DiagnosticsUploader {
+	return func(diagnostics *graylog.CollectorDiagnosticsRequest) error {
+		c := rest.NewClient(httpClient, ctx)
+		c.BaseURL = ctx.ServerUrl
+
+		r, err := c.NewRequest("POST", "/sidecars/"+ctx.NodeId+"/diagnostics", nil, diagnostics)
+		if err != nil {
+			return err
+		}
+		_, err = c.Do(r, nil)
+		return err
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/api/rest"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/helpers"
+)
+
+// EnrollmentClient exchanges a one-time enrollment token for node credentials
+type EnrollmentClient interface {
+	Enroll(enrollmentToken string, request graylog.EnrollmentRequest) (graylog.ResponseEnrollment, error)
+}
+
+type restEnrollmentClient struct {
+	httpClient *http.Client
+	ctx        *context.Ctx
+}
+
+func NewEnrollmentClient(httpClient *http.Client, ctx *context.Ctx) EnrollmentClient {
+	return &restEnrollmentClient{httpClient: httpClient, ctx: ctx}
+}
+
+// Enroll authenticates with the enrollment token instead of an API token
+func (e *restEnrollmentClient) Enroll(enrollmentToken string, request graylog.EnrollmentRequest) (graylog.ResponseEnrollment, error) {
+	c := rest.NewClient(e.httpClient, e.ctx)
+	c.BaseURL = e.ctx.ServerUrl
+	c.ApiToken = enrollmentToken
+
+	response := graylog.ResponseEnrollment{}
+	r, err := c.NewRequest("POST", "/sidecars/enrollment", nil, request)
+	if err != nil {
+		return response, err
+	}
+	_, err = c.Do(r, &response)
+	return response, err
+}
+
+// EnrollNode requests node credentials and stores them at path
+func EnrollNode(client EnrollmentClient, enrollmentToken string, path string, ctx *context.Ctx) error {
+	if enrollmentToken == "" {
+		return errors.New("enrollment token is empty")
+	}
+	request := graylog.EnrollmentRequest{
+		NodeId:          ctx.NodeId,
+		NodeName:        ctx.UserConfig.NodeName,
+		OperatingSystem: helpers.GetSystemName(),
+	}
+	response, err := client.Enroll(enrollmentToken, request)
+	if err != nil {
+		return fmt.Errorf("enrollment request failed: %v", err)
+	}
+	if response.Token == "" {
+		return errors.New("server returned no node credentials")
+	}
+	if response.NodeId != "" && response.NodeId != ctx.NodeId {
+		return fmt.Errorf("server issued credentials for node %s instead of %s", response.NodeId, ctx.NodeId)
+	}
+
+	credentials := &context.NodeCredentials{
+		NodeId:     ctx.NodeId,
+		Token:      response.Token,
+		EnrolledAt: time.Now().UTC(),
+	}
+	if err := context.WriteNodeCredentials(path, credentials); err != nil {
+		return fmt.Errorf("failed to store node credentials: %v", err)
+	}
+	log.Infof("Enrolled node %s, credentials stored in %s", ctx.NodeId, path)
+	return nil
+}
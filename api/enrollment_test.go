@@ -0,0 +1,99 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+type fakeEnrollmentClient struct {
+	response graylog.ResponseEnrollment
+}
+
+func (f *fakeEnrollmentClient) Enroll(enrollmentToken string, request graylog.EnrollmentRequest) (graylog.ResponseEnrollment, error) {
+	return f.response, nil
+}
+
+func newEnrollmentTestContext(t *testing.T, serverUrl string) *context.Ctx {
+	u, err := url.Parse(serverUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &context.Ctx{
+		ServerUrl:  u,
+		NodeId:     "6033137e-d56b-47fc-9762-cd699c11a5a9",
+		UserConfig: &cfgfile.SidecarConfig{NodeName: "test-node"},
+	}
+}
+
+func TestEnrollNode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/sidecars/enrollment" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if token, _, _ := r.BasicAuth(); token != "one-time-token" {
+			http.Error(w, "invalid enrollment token", http.StatusUnauthorized)
+			return
+		}
+		request := graylog.EnrollmentRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(graylog.ResponseEnrollment{NodeId: request.NodeId, Token: "node-token"})
+	}))
+	defer server.Close()
+
+	ctx := newEnrollmentTestContext(t, server.URL+"/api/")
+	path := filepath.Join(t.TempDir(), "node-credentials.json")
+	client := NewEnrollmentClient(server.Client(), ctx)
+
+	if err := EnrollNode(client, "wrong-token", path, ctx); err == nil {
+		t.Fatal("enrollment with an invalid token should fail")
+	}
+	if err := EnrollNode(client, "one-time-token", path, ctx); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := context.ReadNodeCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.NodeId != ctx.NodeId || credentials.Token != "node-token" {
+		t.Fatalf("unexpected credentials %+v", credentials)
+	}
+}
+
+func TestEnrollNodeRejectsForeignCredentials(t *testing.T) {
+	ctx := newEnrollmentTestContext(t, "http://127.0.0.1:9000/api/")
+	path := filepath.Join(t.TempDir(), "node-credentials.json")
+
+	client := &fakeEnrollmentClient{response: graylog.ResponseEnrollment{NodeId: "other-node", Token: "node-token"}}
+	if err := EnrollNode(client, "one-time-token", path, ctx); err == nil {
+		t.Fatal("credentials of another node should be rejected")
+	}
+	client = &fakeEnrollmentClient{response: graylog.ResponseEnrollment{NodeId: ctx.NodeId}}
+	if err := EnrollNode(client, "one-time-token", path, ctx); err == nil {
+		t.Fatal("response without token should be rejected")
+	}
+}
@@ -16,7 +16,6 @@
 package api
 
 import (
-	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -26,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/Graylog2/collector-sidecar/helpers"
+	"github.com/Graylog2/collector-sidecar/install"
 
 	"github.com/Graylog2/collector-sidecar/api/graylog"
 	"github.com/Graylog2/collector-sidecar/api/rest"
@@ -38,6 +38,9 @@ import (
 	"github.com/Graylog2/collector-sidecar/system"
 )
 
+// Maximum MongoDB document size is 16793600 bytes so we leave some extra space for the rest of the request
+const maxFileListSize = 10000000
+
 var (
 	log                   = logger.Log()
 	configurationOverride = false
@@ -168,34 +171,36 @@ func UpdateRegistration(httpClient *http.Client, checksum string, ctx *context.C
 	registration.NodeDetails.OperatingSystem = helpers.GetSystemName()
 
 	if ctx.UserConfig.SendStatus {
-		metrics := &graylog.MetricsRequest{
-			Disks75: common.GetFileSystemList75(ctx.UserConfig.WindowsDriveRange),
-			CpuIdle: common.GetCpuIdle(),
-			Load1:   common.GetLoad1(),
-		}
-		registration.NodeDetails.IP = helpers.GetHostIP()
+		metrics := newMetricsRequest(ctx)
+		registration.NodeDetails.IP = helpers.GetPrimaryIP(ctx.UserConfig.PrimaryIp, ctx.ServerUrl)
 		registration.NodeDetails.Status = status
 		registration.NodeDetails.Metrics = metrics
 		if len(ctx.UserConfig.ListLogFiles) > 0 {
-			fileList := common.ListFiles(ctx.UserConfig.ListLogFiles)
-			buf := new(bytes.Buffer)
-			if fileList != nil {
-				json.NewEncoder(buf).Encode(fileList)
-			}
-			fileListSize := buf.Len()
-			// Maximum MongoDB document size is 16793600 bytes so we leave some extra space for the rest of the request
-			// before we skip to send the file list.
-			if fileListSize < 10000000 {
-				registration.NodeDetails.LogFileList = fileList
-			} else {
-				log.Warn("[UpdateRegistration] Maximum file list size exceeded, skip sending list of active log files!" +
+			// the list is refreshed in the background every log_file_discovery.refresh_interval
+			fileList, truncated := ctx.LogFiles.Files()
+			fileList, cut := limitFileList(fileList, maxFileListSize)
+			if cut {
+				log.Warn("[UpdateRegistration] Maximum file list size exceeded, sending a truncated list of active log files!" +
 					" Adjust list_log_file setting.")
 			}
+			registration.NodeDetails.LogFileList = fileList
+			registration.NodeDetails.LogFileListTruncated = (truncated || cut) && serverVersion.SupportsExtendedNodeDetails()
 		}
 	}
 	if serverVersion.SupportsExtendedNodeDetails() {
 		registration.NodeDetails.CollectorConfigurationDirectory = ctx.UserConfig.CollectorConfigurationDirectory
-		registration.NodeDetails.Tags = ctx.UserConfig.Tags
+		registration.NodeDetails.Tags = ctx.Tags.Collect()
+		registration.NodeDetails.Labels = ctx.UserConfig.Labels
+		if ctx.UserConfig.SendInventory {
+			inventory := ctx.Inventory.Details()
+			registration.NodeDetails.Inventory = &inventory
+			registration.NodeDetails.NetworkInterfaces = helpers.GetNetworkInterfaces()
+		}
+		if ctx.UserConfig.CollectorInstall.Enabled {
+			registration.NodeDetails.InstalledCollectors = install.Installed(ctx.UserConfig.CollectorInstall.Directory)
+		}
+		// results of collector actions from previous registrations
+		registration.NodeDetails.ActionResults = daemon.Actions.PendingResults()
 	}
 
 	r, err := c.NewRequest("PUT", "/sidecars/"+ctx.NodeId, nil, registration)
@@ -204,6 +209,7 @@ func UpdateRegistration(httpClient *http.Client, checksum string, ctx *context.C
 	}
 	if err != nil {
 		log.Error("[UpdateRegistration] Can not initialize REST request")
+		daemon.Actions.RequeueResults(registration.NodeDetails.ActionResults)
 		return graylog.ResponseCollectorRegistration{}, err
 	}
 
@@ -211,6 +217,7 @@ func UpdateRegistration(httpClient *http.Client, checksum string, ctx *context.C
 	resp, err := c.Do(r, &respBody)
 	if resp != nil && resp.StatusCode == 400 && strings.Contains(err.Error(), "Unable to map property") {
 		log.Error("[UpdateRegistration] Sending collector status failed. ", err)
+		daemon.Actions.RequeueResults(registration.NodeDetails.ActionResults)
 		if ctx.UserConfig.SendStatus {
 			log.Error("[UpdateRegistration] Disabling `send_status` as fallback.")
 			ctx.UserConfig.SendStatus = false
@@ -220,9 +227,11 @@ func UpdateRegistration(httpClient *http.Client, checksum string, ctx *context.C
 		respBody.NotModified = true
 	} else if resp != nil && resp.StatusCode != 202 {
 		log.Errorf("[UpdateRegistration] Bad response from server: %v", resp.Status)
+		daemon.Actions.RequeueResults(registration.NodeDetails.ActionResults)
 		return graylog.ResponseCollectorRegistration{}, err
 	} else if err != nil && err != io.EOF { // err is nil for GL 2.2 and EOF for 2.1 and earlier
 		log.Error("[UpdateRegistration] Failed to report collector status to server: ", err)
+		daemon.Actions.RequeueResults(registration.NodeDetails.ActionResults)
 		return graylog.ResponseCollectorRegistration{}, err
 	}
 	respBody.Checksum = resp.Header.Get("Etag")
@@ -234,12 +243,64 @@ func UpdateRegistration(httpClient *http.Client, checksum string, ctx *context.C
 
 	// Run collector actions if provided
 	if len(respBody.CollectorActions) != 0 {
-		daemon.HandleCollectorActions(respBody.CollectorActions)
+		daemon.HandleCollectorActions(respBody.CollectorActions, ctx, NewDiagnosticsUploader(httpClient, ctx))
 	}
 
 	return *respBody, nil
 }
 
+// limitFileList cuts the file list to fit into maxSize bytes of JSON, the second result is true if it was cut
+func limitFileList(files []common.File, maxSize int) ([]common.File, bool) {
+	size := 1 // opening bracket, each entry adds a comma or the closing bracket
+	for i, file := range files {
+		entry, err := json.Marshal(file)
+		if err != nil {
+			return files[:i], true
+		}
+		size += len(entry) + 1
+		if size > maxSize {
+			return files[:i], true
+		}
+	}
+	return files, false
+}
+
+func newMetricsRequest(ctx *context.Ctx) *graylog.MetricsRequest {
+	diskUsage := ctx.UserConfig.DiskUsage
+	filter := &common.FileSystemFilter{
+		WindowsDriveRange:  ctx.UserConfig.WindowsDriveRange,
+		IncludeMountPoints: diskUsage.IncludeMountPoints,
+		ExcludeMountPoints: diskUsage.ExcludeMountPoints,
+		IncludeFsTypes:     diskUsage.IncludeFsTypes,
+		ExcludeFsTypes:     diskUsage.ExcludeFsTypes,
+	}
+	metrics := &graylog.MetricsRequest{
+		// still called disks_75 for compatibility, the threshold is configurable
+		Disks75: common.GetFileSystemList(filter, diskUsage.WarningThreshold),
+		CpuIdle: common.GetCpuIdle(),
+		Load1:   common.GetLoad1(),
+	}
+	for _, group := range ctx.UserConfig.MetricGroups {
+		switch group {
+		case common.MetricGroupCpu:
+			metrics.Cpu = common.GetCpuMetrics()
+		case common.MetricGroupMemory:
+			metrics.Memory = common.GetMemoryMetrics()
+		case common.MetricGroupLoad:
+			metrics.Load = common.GetLoadMetrics()
+		case common.MetricGroupFileSystems:
+			metrics.FileSystems = common.GetFileSystemMetrics(filter)
+		case common.MetricGroupSystem:
+			metrics.System = common.GetSystemMetrics()
+		case common.MetricGroupNetwork:
+			metrics.NetworkInterfaces = common.GetNetworkInterfaceMetrics()
+		case common.MetricGroupDisks:
+			metrics.Disks = common.GetDiskUsageMetrics(filter, diskUsage.WarningThreshold, diskUsage.CriticalThreshold)
+		}
+	}
+	return metrics
+}
+
 func updateRuntimeConfiguration(respBody *graylog.ResponseCollectorRegistration, ctx *context.Ctx) error {
 	// API query interval
 	if ctx.UserConfig.UpdateInterval != respBody.Configuration.UpdateInterval &&
@@ -288,10 +349,10 @@ func NewStatusRequest(serverVersion *GraylogVersion) graylog.StatusRequest {
 	runningCount, stoppedCount, errorCount := 0, 0, 0
 
 	for id, runner := range daemon.Daemon.Runner {
-		collectorId := strings.Split(id, "-")[0]
+		collectorId := id.CollectorId
 		configurationId := ""
 		if serverVersion.SupportsMultipleBackends() {
-			configurationId = strings.Split(id, "-")[1]
+			configurationId = id.ConfigurationId
 		}
 		backendStatus := runner.GetBackend().Status()
 		statusRequest.Backends = append(statusRequest.Backends, graylog.StatusRequestBackend{
@@ -300,6 +361,8 @@ func NewStatusRequest(serverVersion *GraylogVersion) graylog.StatusRequest {
 			Status:          backendStatus.Status,
 			Message:         backendStatus.Message,
 			VerboseMessage:  backendStatus.VerboseMessage,
+			Local:           runner.GetBackend().Local,
+			Version:         collectorVersion(runner.GetBackend(), serverVersion),
 		})
 		switch backendStatus.Status {
 		case backends.StatusRunning:
@@ -337,3 +400,11 @@ func NewStatusRequest(serverVersion *GraylogVersion) graylog.StatusRequest {
 
 	return statusRequest
 }
+
+// older servers reject unknown properties in the collector status
+func collectorVersion(backend *backends.Backend, serverVersion *GraylogVersion) string {
+	if !serverVersion.SupportsExtendedNodeDetails() {
+		return ""
+	}
+	return backend.Version()
+}
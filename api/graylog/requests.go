@@ -17,6 +17,8 @@ package graylog
 
 import (
 	"github.com/Graylog2/collector-sidecar/common"
+	"github.com/Graylog2/collector-sidecar/helpers"
+	"github.com/Graylog2/collector-sidecar/system"
 )
 
 type RegistrationRequest struct {
@@ -24,14 +26,54 @@ type RegistrationRequest struct {
 	NodeDetails NodeDetailsRequest `json:"node_details"`
 }
 
+type EnrollmentRequest struct {
+	NodeId          string `json:"node_id"`
+	NodeName        string `json:"node_name"`
+	OperatingSystem string `json:"operating_system"`
+}
+
 type NodeDetailsRequest struct {
-	OperatingSystem                 string          `json:"operating_system"`
-	IP                              string          `json:"ip,omitempty"`
-	LogFileList                     []common.File   `json:"log_file_list,omitempty"`
-	Metrics                         *MetricsRequest `json:"metrics,omitempty"`
-	Status                          *StatusRequest  `json:"status,omitempty"`
-	CollectorConfigurationDirectory string          `json:"collector_configuration_directory,omitempty"`
-	Tags                            []string        `json:"tags,omitempty"`
+	OperatingSystem                 string                      `json:"operating_system"`
+	IP                              string                      `json:"ip,omitempty"`
+	LogFileList                     []common.File               `json:"log_file_list,omitempty"`
+	LogFileListTruncated            bool                        `json:"log_file_list_truncated,omitempty"`
+	Metrics                         *MetricsRequest             `json:"metrics,omitempty"`
+	Status                          *StatusRequest              `json:"status,omitempty"`
+	CollectorConfigurationDirectory string                      `json:"collector_configuration_directory,omitempty"`
+	Tags                            []string                    `json:"tags,omitempty"`
+	Labels                          map[string]string           `json:"labels,omitempty"`
+	Inventory                       *system.Details             `json:"inventory,omitempty"`
+	ActionResults                   []ActionResultRequest       `json:"action_results,omitempty"`
+	NetworkInterfaces               []helpers.NetworkInterface  `json:"network_interfaces,omitempty"`
+	InstalledCollectors             []InstalledCollectorRequest `json:"installed_collectors,omitempty"`
+}
+
+// InstalledCollectorRequest reports a collector binary managed by the sidecar
+type InstalledCollectorRequest struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	InstallPath string `json:"install_path"`
+}
+
+// ActionResultRequest reports the outcome of a collector action with an ID
+type ActionResultRequest struct {
+	ActionId    string `json:"action_id"`
+	CollectorId string `json:"collector_id"`
+	Success     bool   `json:"success"`
+	Message     string `json:"message,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+// CollectorDiagnosticsRequest is uploaded for the "diagnostics" collector action
+type CollectorDiagnosticsRequest struct {
+	CollectorId      string `json:"collector_id"`
+	ConfigurationId  string `json:"configuration_id,omitempty"`
+	Stdout           string `json:"stdout"`
+	Stderr           string `json:"stderr"`
+	Configuration    string `json:"configuration"`
+	ValidationOutput string `json:"validation_output"`
+	ValidationError  string `json:"validation_error,omitempty"`
+	Truncated        bool   `json:"truncated"`
 }
 
 type StatusRequestBackend struct {
@@ -40,6 +82,8 @@ type StatusRequestBackend struct {
 	Status          int    `json:"status"`
 	Message         string `json:"message"`
 	VerboseMessage  string `json:"verbose_message"`
+	Local           bool   `json:"local,omitempty"`
+	Version         string `json:"version,omitempty"`
 }
 
 type StatusRequest struct {
@@ -52,4 +96,13 @@ type MetricsRequest struct {
 	Disks75 []string `json:"disks_75"`
 	CpuIdle float64  `json:"cpu_idle"`
 	Load1   float64  `json:"load_1"`
+
+	// optional metric groups, see `metric_groups`
+	Cpu               *common.CpuMetrics               `json:"cpu,omitempty"`
+	Memory            *common.MemoryMetrics            `json:"memory,omitempty"`
+	Load              *common.LoadMetrics              `json:"load,omitempty"`
+	FileSystems       []common.FileSystemMetrics       `json:"filesystems,omitempty"`
+	System            *common.SystemMetrics            `json:"system,omitempty"`
+	NetworkInterfaces []common.NetworkInterfaceMetrics `json:"network_interfaces,omitempty"`
+	Disks             []common.DiskUsageMetrics        `json:"disks,omitempty"`
 }
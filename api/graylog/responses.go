@@ -22,15 +22,47 @@ type ResponseCollectorRegistration struct {
 	ConfigurationOverride bool                                       `json:"configuration_override"`
 	CollectorActions      []ResponseCollectorAction                  `json:"actions,omitempty"`
 	Assignments           []assignments.ConfigurationAssignment      `json:"assignments,omitempty"`
+	SelfUpdate            *ResponseUpdateManifest                    `json:"self_update,omitempty"`
+	CollectorPackages     []ResponseCollectorPackage                 `json:"collector_packages,omitempty"`
 	Checksum              string                                     //Etag of the response
 	NotModified           bool
 }
 
 type ResponseCollectorAction struct {
+	Id         string                 `json:"id,omitempty"`
 	BackendId  string                 `json:"collector_id"`
 	Properties map[string]interface{} `json:"properties"`
 }
 
+// ResponseUpdateManifest advertises the sidecar version a node should run
+type ResponseUpdateManifest struct {
+	Version   string                   `json:"version"`
+	Artifacts []ResponseUpdateArtifact `json:"artifacts"`
+}
+
+// ResponseUpdateArtifact is the sidecar binary for one platform. The signature is a base64 encoded
+// Ed25519 signature of "<version>|<os>|<arch>|<sha256>", the checksum in lower case hex.
+type ResponseUpdateArtifact struct {
+	Os        string `json:"os"`
+	Arch      string `json:"arch"`
+	Url       string `json:"url"`
+	Sha256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// ResponseCollectorPackage is a collector binary the sidecar installs and links to InstallPath. The signature
+// is a base64 encoded Ed25519 signature of "<name>|<version>|<os>|<arch>|<sha256>", the checksum in lower case hex.
+type ResponseCollectorPackage struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Os          string `json:"os"`
+	Arch        string `json:"arch"`
+	Url         string `json:"url"`
+	Sha256      string `json:"sha256"`
+	Signature   string `json:"signature"`
+	InstallPath string `json:"install_path"`
+}
+
 type ResponseCollectorRegistrationConfiguration struct {
 	UpdateInterval int  `json:"update_interval"`
 	SendStatus     bool `json:"send_status"`
@@ -42,6 +74,11 @@ type ResponseBackendList struct {
 	NotModified bool
 }
 
+type ResponseEnrollment struct {
+	NodeId string `json:"node_id"`
+	Token  string `json:"token"`
+}
+
 type ServerVersionResponse struct {
 	ClusterId string `json:"cluster_id"`
 	NodeId    string `json:"node_id"`
@@ -56,6 +93,7 @@ type ResponseCollectorBackend struct {
 	ExecutablePath       string `json:"executable_path"`
 	ExecuteParameters    string `json:"execute_parameters"`
 	ValidationParameters string `json:"validation_parameters"`
+	VersionParameters    string `json:"version_parameters,omitempty"`
 }
 
 type ResponseCollectorConfiguration struct {
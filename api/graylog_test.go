@@ -0,0 +1,44 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/common"
+)
+
+func TestLimitFileList(t *testing.T) {
+	var files []common.File
+	for i := 0; i < 100; i++ {
+		files = append(files, common.File{Path: fmt.Sprintf("/var/log/app-%03d.log", i)})
+	}
+	full, _ := json.Marshal(files)
+
+	if list, cut := limitFileList(files, len(full)); len(list) != len(files) || cut {
+		t.Fatalf("expected the complete list, got %d entries, cut %v", len(list), cut)
+	}
+
+	list, cut := limitFileList(files, len(full)/2)
+	if !cut || len(list) == 0 || len(list) >= len(files) {
+		t.Fatalf("expected a truncated list, got %d entries, cut %v", len(list), cut)
+	}
+	if encoded, _ := json.Marshal(list); len(encoded) > len(full)/2 {
+		t.Fatalf("truncated list has %d bytes, limit is %d", len(encoded), len(full)/2)
+	}
+}
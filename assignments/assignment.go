@@ -16,17 +16,18 @@
 package assignments
 
 import (
-	"github.com/Graylog2/collector-sidecar/helpers"
 	"reflect"
 )
 
 var (
-	// global store of configuration assignments, [backendId-configurationID]ConfigurationId
-	Store = &assignmentStore{make(map[string]string)}
+	// global store of configuration assignments, [BackendKey]ConfigurationId
+	Store = &assignmentStore{assignments: make(map[BackendKey]string), local: make(map[BackendKey]bool)}
 )
 
 type assignmentStore struct {
-	assignments map[string]string
+	assignments map[BackendKey]string
+	// assignments defined in the local sidecar configuration, they survive every update from the server
+	local map[BackendKey]bool
 }
 
 type ConfigurationAssignment struct {
@@ -34,66 +35,99 @@ type ConfigurationAssignment struct {
 	ConfigurationId string `json:"configuration_id"`
 }
 
-func (as *assignmentStore) SetAssignment(backendId string, configId string) {
-	if as.assignments[backendId] != configId {
-		as.assignments[backendId] = configId
+// BackendKey identifies a collector instance by the collector ID and the ID of the
+// configuration that is assigned to it. Both IDs are kept separately, so they can
+// contain any characters.
+type BackendKey struct {
+	CollectorId     string
+	ConfigurationId string
+}
+
+func NewBackendKey(collectorId string, configurationId string) BackendKey {
+	return BackendKey{CollectorId: collectorId, ConfigurationId: configurationId}
+}
+
+// String is meant for log messages only, it can't be split into its parts again.
+func (k BackendKey) String() string {
+	return k.CollectorId + "-" + k.ConfigurationId
+}
+
+func (as *assignmentStore) SetAssignment(key BackendKey, configId string) {
+	if as.assignments[key] != configId {
+		as.assignments[key] = configId
 	}
 }
 
-func (as *assignmentStore) GetAssignment(backendId string) string {
-	return as.assignments[backendId]
+func (as *assignmentStore) GetAssignment(key BackendKey) string {
+	return as.assignments[key]
+}
+
+// SetLocalAssignments replaces the set of locally defined assignments. They get merged
+// into the store on the next Update.
+func (as *assignmentStore) SetLocalAssignments(assignments []ConfigurationAssignment) {
+	as.local = make(map[BackendKey]bool)
+	for key := range expandAssignments(assignments) {
+		as.local[key] = true
+	}
+}
+
+func (as *assignmentStore) IsLocal(key BackendKey) bool {
+	return as.local[key]
 }
 
 func (as *assignmentStore) Len() int {
 	return len(as.assignments)
 }
 
-func (as *assignmentStore) GetAll() map[string]string {
+func (as *assignmentStore) GetAll() map[BackendKey]string {
 	return as.assignments
 }
 
-func (as *assignmentStore) AssignedBackendIds() []string {
-	var result []string
-	for backendId := range as.assignments {
-		result = append(result, backendId)
+func (as *assignmentStore) AssignedBackendIds() []BackendKey {
+	var result []BackendKey
+	for key := range as.assignments {
+		result = append(result, key)
 	}
 	return result
 }
 
-func expandAssignments(assignments []ConfigurationAssignment) map[string]string {
-	expandedAssignments := make(map[string]string)
+func expandAssignments(assignments []ConfigurationAssignment) map[BackendKey]string {
+	expandedAssignments := make(map[BackendKey]string)
 
 	for _, assignment := range assignments {
 		configId := assignment.ConfigurationId
-		expandedAssignments[assignment.BackendId+"-"+configId] = configId
+		expandedAssignments[NewBackendKey(assignment.BackendId, configId)] = configId
 	}
 	return expandedAssignments
 }
 
 func (as *assignmentStore) Update(assignments []ConfigurationAssignment) bool {
 	expandedAssignments := expandAssignments(assignments)
+	for key := range as.local {
+		expandedAssignments[key] = key.ConfigurationId
+	}
 
-	beforeUpdate := make(map[string]string)
+	beforeUpdate := make(map[BackendKey]string)
 	for k, v := range as.assignments {
 		beforeUpdate[k] = v
 	}
 	if len(expandedAssignments) != 0 {
-		var activeIds []string
-		for backendId, assignment := range expandedAssignments {
-			Store.SetAssignment(backendId, assignment)
-			activeIds = append(activeIds, backendId)
+		activeKeys := make(map[BackendKey]bool)
+		for key, assignment := range expandedAssignments {
+			Store.SetAssignment(key, assignment)
+			activeKeys[key] = true
 		}
-		Store.cleanup(activeIds)
+		Store.cleanup(activeKeys)
 	} else {
-		Store.cleanup([]string{})
+		Store.cleanup(map[BackendKey]bool{})
 	}
 	return !reflect.DeepEqual(beforeUpdate, as.assignments)
 }
 
-func (as *assignmentStore) cleanup(validBackendIds []string) {
-	for backendId := range as.assignments {
-		if !helpers.IsInList(backendId, validBackendIds) {
-			delete(as.assignments, backendId)
+func (as *assignmentStore) cleanup(validKeys map[BackendKey]bool) {
+	for key := range as.assignments {
+		if !validKeys[key] {
+			delete(as.assignments, key)
 		}
 	}
 }
@@ -0,0 +1,71 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package assignments
+
+import "testing"
+
+func TestUpdateKeepsHyphenatedIdsApart(t *testing.T) {
+	Store = &assignmentStore{assignments: make(map[BackendKey]string), local: make(map[BackendKey]bool)}
+
+	// both combinations would collapse to "a-b-c" when joined with a hyphen
+	modified := Store.Update([]ConfigurationAssignment{
+		{BackendId: "a-b", ConfigurationId: "c"},
+		{BackendId: "a", ConfigurationId: "b-c"},
+	})
+	if !modified {
+		t.Fatalf("first update should modify the store")
+	}
+	if Store.Len() != 2 {
+		t.Fatalf("expected 2 assignments, got %d: %v", Store.Len(), Store.GetAll())
+	}
+
+	key := NewBackendKey("6033137e-d56b-47fc-9762-cd699c11a5a9", "5f0d6e8c-1a2b-4c3d-8e9f-0a1b2c3d4e5f")
+	Store.Update([]ConfigurationAssignment{{BackendId: key.CollectorId, ConfigurationId: key.ConfigurationId}})
+	if Store.Len() != 1 || Store.GetAssignment(key) != key.ConfigurationId {
+		t.Fatalf("unexpected assignments after update: %v", Store.GetAll())
+	}
+	for assignedKey := range Store.GetAll() {
+		if assignedKey.CollectorId != key.CollectorId || assignedKey.ConfigurationId != key.ConfigurationId {
+			t.Fatalf("key parts changed: %#v", assignedKey)
+		}
+	}
+
+	if Store.Update([]ConfigurationAssignment{{BackendId: key.CollectorId, ConfigurationId: key.ConfigurationId}}) {
+		t.Fatalf("identical update should not modify the store")
+	}
+}
+
+func TestUpdateKeepsLocalAssignments(t *testing.T) {
+	Store = &assignmentStore{assignments: make(map[BackendKey]string), local: make(map[BackendKey]bool)}
+
+	localKey := NewBackendKey("auditbeat", "audit")
+	Store.SetLocalAssignments([]ConfigurationAssignment{{BackendId: "auditbeat", ConfigurationId: "audit"}})
+	Store.Update([]ConfigurationAssignment{{BackendId: "5f0d", ConfigurationId: "6033"}})
+	if Store.Len() != 2 || !Store.IsLocal(localKey) {
+		t.Fatalf("local assignment should be merged with server assignments: %v", Store.GetAll())
+	}
+
+	// the server removing all assignments must not remove the local one
+	Store.Update([]ConfigurationAssignment{})
+	if Store.Len() != 1 || Store.GetAssignment(localKey) != "audit" {
+		t.Fatalf("local assignment should survive server updates: %v", Store.GetAll())
+	}
+
+	Store.SetLocalAssignments(nil)
+	if !Store.Update(nil) || Store.Len() != 0 {
+		t.Fatalf("removed local assignment should be cleaned up: %v", Store.GetAll())
+	}
+}
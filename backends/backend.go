@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"github.com/Graylog2/collector-sidecar/helpers"
 	"os/exec"
-	"path/filepath"
 	"reflect"
 	"runtime"
 	"time"
@@ -28,15 +27,18 @@ import (
 	"github.com/flynn-archive/go-shlex"
 
 	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/assignments"
+	"github.com/Graylog2/collector-sidecar/common"
 	"github.com/Graylog2/collector-sidecar/context"
 	"github.com/Graylog2/collector-sidecar/system"
 )
 
 type Backend struct {
 	Enabled              *bool
-	Id                   string
+	Id                   assignments.BackendKey
 	ConfigId             string
 	CollectorId          string
+	CollectorName        string
 	Name                 string
 	ServiceType          string
 	OperatingSystem      string
@@ -44,29 +46,70 @@ type Backend struct {
 	ConfigurationPath    string
 	ExecuteParameters    string
 	ValidationParameters string
+	VersionParameters    string
 	Template             string
+	Local                bool // defined in the local sidecar configuration, not managed by the server
 	backendStatus        system.VerboseStatus
+	version              string
 }
 
 func BackendFromResponse(response graylog.ResponseCollectorBackend, configId string, ctx *context.Ctx) *Backend {
-	return &Backend{
+	configurationPath, err := BuildConfigurationPath(response, configId, ctx)
+	backend := &Backend{
 		Enabled:              helpers.NewTrue(),
-		Id:                   response.Id + "-" + configId,
+		Id:                   assignments.NewBackendKey(response.Id, configId),
 		CollectorId:          response.Id,
+		CollectorName:        response.Name,
 		ConfigId:             configId,
 		Name:                 response.Name + "-" + configId,
 		ServiceType:          response.ServiceType,
 		OperatingSystem:      response.OperatingSystem,
 		ExecutablePath:       response.ExecutablePath,
-		ConfigurationPath:    BuildConfigurationPath(response, configId, ctx),
+		ConfigurationPath:    configurationPath,
 		ExecuteParameters:    response.ExecuteParameters,
 		ValidationParameters: response.ValidationParameters,
+		VersionParameters:    response.VersionParameters,
 		backendStatus:        system.VerboseStatus{},
 	}
+	if err != nil {
+		backend.SetStatusLogErrorf("Rejecting collector: %s", err)
+	}
+	return backend
 }
 
-func BuildConfigurationPath(response graylog.ResponseCollectorBackend, configId string, ctx *context.Ctx) string {
-	return filepath.Join(ctx.UserConfig.CollectorConfigurationDirectory, configId, response.Name+".conf")
+// BuildConfigurationPath returns `<collector_configuration_directory>/<configId>/<name>.conf`.
+// The collector name and configuration ID are provided by the server and must be valid path elements.
+func BuildConfigurationPath(response graylog.ResponseCollectorBackend, configId string, ctx *context.Ctx) (string, error) {
+	if err := common.ValidatePathElement(response.Name); err != nil {
+		return "", fmt.Errorf("invalid collector name: %s", err)
+	}
+	if err := common.ValidatePathElement(configId); err != nil {
+		return "", fmt.Errorf("invalid configuration ID: %s", err)
+	}
+	return common.JoinPathInside(ctx.UserConfig.CollectorConfigurationDirectory, configId, response.Name+".conf")
+}
+
+// BuildLogPath returns the path of the collector's stdout or stderr log file inside `log_path`.
+func BuildLogPath(ctx *context.Ctx, name string, stream string) (string, error) {
+	if err := common.ValidatePathElement(name); err != nil {
+		return "", fmt.Errorf("invalid collector name: %s", err)
+	}
+	return common.JoinPathInside(ctx.UserConfig.LogPath, name+"_"+stream+".log")
+}
+
+// CheckIdentifiers verifies that the server provided names of this backend can be safely
+// used to build file paths and service names.
+func (b *Backend) CheckIdentifiers() error {
+	if err := common.ValidatePathElement(b.Name); err != nil {
+		return fmt.Errorf("Invalid collector name: %s", err)
+	}
+	if err := common.ValidatePathElement(b.ConfigId); err != nil {
+		return fmt.Errorf("Invalid configuration ID: %s", err)
+	}
+	if b.ConfigurationPath == "" {
+		return fmt.Errorf("No valid configuration path")
+	}
+	return nil
 }
 
 func (b *Backend) Equals(a *Backend) bool {
@@ -86,6 +129,7 @@ func (b *Backend) EqualSettings(a *Backend) bool {
 		Id:                   a.Id,
 		ConfigId:             a.ConfigId,
 		CollectorId:          a.CollectorId,
+		CollectorName:        a.CollectorName,
 		Name:                 a.Name,
 		ServiceType:          a.ServiceType,
 		OperatingSystem:      a.OperatingSystem,
@@ -93,8 +137,11 @@ func (b *Backend) EqualSettings(a *Backend) bool {
 		ConfigurationPath:    a.ConfigurationPath,
 		ExecuteParameters:    executeParameters,
 		ValidationParameters: validationParameters,
+		VersionParameters:    a.VersionParameters,
 		Template:             b.Template,
+		Local:                a.Local,
 		backendStatus:        b.Status(),
+		version:              b.version,
 	}
 
 	return b.Equals(aBackend)
@@ -0,0 +1,130 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+func newPathTestContext() *context.Ctx {
+	return &context.Ctx{UserConfig: &cfgfile.SidecarConfig{
+		CollectorConfigurationDirectory: filepath.Join(string(filepath.Separator), "var", "lib", "sidecar", "generated"),
+		LogPath:                         filepath.Join(string(filepath.Separator), "var", "log", "sidecar"),
+	}}
+}
+
+// assertInside fails if path is not a direct or nested child of dir
+func assertInside(t *testing.T, dir string, path string) {
+	t.Helper()
+	relativePath, err := filepath.Rel(dir, path)
+	if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") || filepath.IsAbs(relativePath) {
+		t.Fatalf("path %q escapes %q", path, dir)
+	}
+}
+
+func TestBuildConfigurationPath(t *testing.T) {
+	ctx := newPathTestContext()
+	response := graylog.ResponseCollectorBackend{Id: "5f0d", Name: "filebeat"}
+
+	path, err := BuildConfigurationPath(response, "6033137e", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(ctx.UserConfig.CollectorConfigurationDirectory, "6033137e", "filebeat.conf")
+	if path != expected {
+		t.Fatalf("expected %s, got %s", expected, path)
+	}
+
+	for _, name := range []string{"../filebeat", "file/beat", "..", ".hidden", "", "con", "-flag", "file\\beat"} {
+		response.Name = name
+		if _, err := BuildConfigurationPath(response, "6033137e", ctx); err == nil {
+			t.Errorf("collector name %q should be rejected", name)
+		}
+	}
+
+	response.Name = "filebeat"
+	for _, configId := range []string{"../../etc", "a/b", "..", ""} {
+		if _, err := BuildConfigurationPath(response, configId, ctx); err == nil {
+			t.Errorf("configuration ID %q should be rejected", configId)
+		}
+	}
+}
+
+func TestBackendFromResponseRejectsInvalidNames(t *testing.T) {
+	ctx := newPathTestContext()
+	response := graylog.ResponseCollectorBackend{Id: "5f0d", Name: "../../../tmp/evil"}
+
+	backend := BackendFromResponse(response, "6033137e", ctx)
+	if backend.ConfigurationPath != "" {
+		t.Fatalf("rejected backend must not have a configuration path: %s", backend.ConfigurationPath)
+	}
+	if backend.Status().Status != StatusError {
+		t.Fatalf("rejected backend should be marked as failing")
+	}
+	if err := backend.CheckIdentifiers(); err == nil {
+		t.Fatalf("rejected backend should fail the identifier check")
+	}
+}
+
+func FuzzBuildConfigurationPath(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"filebeat", "6033137e-d56b-47fc-9762-cd699c11a5a9"},
+		{"../filebeat", "config"},
+		{"filebeat", "../../etc"},
+		{"nxlog", "..\\..\\windows"},
+		{"a/../../b", "c"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	ctx := newPathTestContext()
+
+	f.Fuzz(func(t *testing.T, name string, configId string) {
+		path, err := BuildConfigurationPath(graylog.ResponseCollectorBackend{Name: name}, configId, ctx)
+		if err != nil {
+			return
+		}
+		assertInside(t, ctx.UserConfig.CollectorConfigurationDirectory, path)
+		if filepath.Base(filepath.Dir(path)) != configId || filepath.Base(path) != name+".conf" {
+			t.Fatalf("unexpected path layout %q for name %q and configuration %q", path, name, configId)
+		}
+	})
+}
+
+func FuzzBuildLogPath(f *testing.F) {
+	for _, seed := range []string{"filebeat-6033137e", "../sidecar", "..", "a/b", "c:\\windows"} {
+		f.Add(seed)
+	}
+	ctx := newPathTestContext()
+
+	f.Fuzz(func(t *testing.T, name string) {
+		for _, stream := range []string{"stdout", "stderr"} {
+			path, err := BuildLogPath(ctx, name, stream)
+			if err != nil {
+				continue
+			}
+			assertInside(t, ctx.UserConfig.LogPath, path)
+			if filepath.Dir(path) != ctx.UserConfig.LogPath {
+				t.Fatalf("log file %q is not placed directly in %q", path, ctx.UserConfig.LogPath)
+			}
+		}
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+type orphanedConfiguration struct {
+	firstSeen time.Time
+	reported  bool
+}
+
+// CleanupConfigurations removes rendered configuration files of backends that are not
+// assigned anymore. Only `<collector_configuration_directory>/<configId>/*.conf` files are
+// considered, and they have to stay orphaned for the configured grace period before
+// they get deleted. Symlinks are never followed.
+func (bs *backendStore) CleanupConfigurations(context *context.Ctx) {
+	if !context.UserConfig.CollectorConfigurationCleanup {
+		return
+	}
+
+	baseDir := filepath.Clean(context.UserConfig.CollectorConfigurationDirectory)
+	if !filepath.IsAbs(baseDir) || filepath.Dir(baseDir) == baseDir {
+		log.Errorf("[ConfigurationCleanup] Refusing to clean up configuration directory %s", baseDir)
+		return
+	}
+
+	activePaths := make(map[string]bool)
+	for _, backend := range bs.backends {
+		if backend.ConfigurationPath != "" {
+			activePaths[filepath.Clean(backend.ConfigurationPath)] = true
+		}
+	}
+
+	configDirs, err := os.ReadDir(baseDir)
+	if err != nil {
+		log.Errorf("[ConfigurationCleanup] Can not read configuration directory %s: %v", baseDir, err)
+		return
+	}
+
+	now := time.Now()
+	gracePeriod := context.UserConfig.CollectorConfigurationCleanupGracePeriod
+	dryRun := context.UserConfig.CollectorConfigurationCleanupDryRun
+	orphans := make(map[string]bool)
+	for _, configDir := range configDirs {
+		// DirEntry types are taken from Lstat, so symlinked directories are skipped here
+		if !configDir.IsDir() {
+			continue
+		}
+		dirPath := filepath.Join(baseDir, configDir.Name())
+		files, err := os.ReadDir(dirPath)
+		if err != nil {
+			log.Errorf("[ConfigurationCleanup] Can not read configuration directory %s: %v", dirPath, err)
+			continue
+		}
+
+		for _, file := range files {
+			if !file.Type().IsRegular() || filepath.Ext(file.Name()) != ".conf" {
+				continue
+			}
+			path := filepath.Join(dirPath, file.Name())
+			if activePaths[path] {
+				continue
+			}
+			orphans[path] = true
+
+			orphan := bs.orphanedConfigurations[path]
+			if orphan == nil {
+				log.Debugf("[ConfigurationCleanup] Found orphaned configuration %s", path)
+				orphan = &orphanedConfiguration{firstSeen: now}
+				bs.orphanedConfigurations[path] = orphan
+			}
+			if now.Sub(orphan.firstSeen) < gracePeriod {
+				continue
+			}
+
+			if dryRun {
+				if !orphan.reported {
+					log.Infof("[ConfigurationCleanup] Dry run, would remove orphaned configuration %s", path)
+					orphan.reported = true
+				}
+				continue
+			}
+			if err := removeOrphanedConfiguration(baseDir, path); err != nil {
+				log.Errorf("[ConfigurationCleanup] Failed to remove orphaned configuration %s: %v", path, err)
+				continue
+			}
+			log.Infof("[ConfigurationCleanup] Removed orphaned configuration %s", path)
+			delete(bs.orphanedConfigurations, path)
+			delete(orphans, path)
+		}
+
+		if !dryRun {
+			removeEmptyConfigurationDirectory(dirPath, activePaths)
+		}
+	}
+
+	// forget about files that were removed by someone else or got assigned again
+	for path := range bs.orphanedConfigurations {
+		if !orphans[path] {
+			delete(bs.orphanedConfigurations, path)
+		}
+	}
+}
+
+func removeOrphanedConfiguration(baseDir string, path string) error {
+	if !isInsideDirectory(baseDir, path) {
+		return os.ErrPermission
+	}
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return os.ErrInvalid
+	}
+	return os.Remove(path)
+}
+
+func removeEmptyConfigurationDirectory(dirPath string, activePaths map[string]bool) {
+	for path := range activePaths {
+		if filepath.Dir(path) == dirPath {
+			return
+		}
+	}
+	files, err := os.ReadDir(dirPath)
+	if err != nil || len(files) != 0 {
+		return
+	}
+	if err := os.Remove(dirPath); err != nil {
+		log.Errorf("[ConfigurationCleanup] Failed to remove empty configuration directory %s: %v", dirPath, err)
+		return
+	}
+	log.Debugf("[ConfigurationCleanup] Removed empty configuration directory %s", dirPath)
+}
+
+func isInsideDirectory(baseDir string, path string) bool {
+	relativePath, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return false
+	}
+	return relativePath != "." && relativePath != ".." &&
+		!strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) &&
+		!filepath.IsAbs(relativePath)
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/assignments"
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+func newCleanupTestStore(t *testing.T, gracePeriod time.Duration, dryRun bool) (*backendStore, *context.Ctx) {
+	t.Helper()
+	ctx := &context.Ctx{UserConfig: &cfgfile.SidecarConfig{
+		CollectorConfigurationDirectory:          t.TempDir(),
+		CollectorConfigurationCleanup:            true,
+		CollectorConfigurationCleanupGracePeriod: gracePeriod,
+		CollectorConfigurationCleanupDryRun:      dryRun,
+	}}
+	store := &backendStore{
+		backends:               make(map[assignments.BackendKey]*Backend),
+		orphanedConfigurations: make(map[string]*orphanedConfiguration),
+	}
+	return store, ctx
+}
+
+func writeTestConfiguration(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanupConfigurationsRemovesOrphans(t *testing.T) {
+	store, ctx := newCleanupTestStore(t, 0, false)
+	baseDir := ctx.UserConfig.CollectorConfigurationDirectory
+
+	active := filepath.Join(baseDir, "config-1", "filebeat.conf")
+	orphan := filepath.Join(baseDir, "config-2", "filebeat.conf")
+	unmanaged := filepath.Join(baseDir, "config-3", "notes.txt")
+	writeTestConfiguration(t, active)
+	writeTestConfiguration(t, orphan)
+	writeTestConfiguration(t, unmanaged)
+	key := assignments.NewBackendKey("collector", "config-1")
+	store.backends[key] = &Backend{Id: key, ConfigurationPath: active}
+
+	store.CleanupConfigurations(ctx)
+
+	if _, err := os.Stat(active); err != nil {
+		t.Fatalf("assigned configuration must not be removed: %v", err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("orphaned configuration should be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(orphan)); !os.IsNotExist(err) {
+		t.Fatalf("empty configuration directory should be removed, got %v", err)
+	}
+	if _, err := os.Stat(unmanaged); err != nil {
+		t.Fatalf("files without .conf extension must not be removed: %v", err)
+	}
+}
+
+func TestCleanupConfigurationsGracePeriod(t *testing.T) {
+	store, ctx := newCleanupTestStore(t, time.Hour, false)
+	orphan := filepath.Join(ctx.UserConfig.CollectorConfigurationDirectory, "config-2", "filebeat.conf")
+	writeTestConfiguration(t, orphan)
+
+	store.CleanupConfigurations(ctx)
+	if _, err := os.Stat(orphan); err != nil {
+		t.Fatalf("orphaned configuration must survive the grace period: %v", err)
+	}
+
+	store.orphanedConfigurations[orphan].firstSeen = time.Now().Add(-2 * time.Hour)
+	store.CleanupConfigurations(ctx)
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("orphaned configuration should be removed after the grace period, got %v", err)
+	}
+}
+
+func TestCleanupConfigurationsDryRun(t *testing.T) {
+	store, ctx := newCleanupTestStore(t, 0, true)
+	orphan := filepath.Join(ctx.UserConfig.CollectorConfigurationDirectory, "config-2", "filebeat.conf")
+	writeTestConfiguration(t, orphan)
+
+	store.CleanupConfigurations(ctx)
+	if _, err := os.Stat(orphan); err != nil {
+		t.Fatalf("dry run must not remove files: %v", err)
+	}
+	if !store.orphanedConfigurations[orphan].reported {
+		t.Fatalf("dry run should report the orphaned configuration")
+	}
+}
+
+func TestCleanupConfigurationsIgnoresSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	store, ctx := newCleanupTestStore(t, 0, false)
+	outside := filepath.Join(t.TempDir(), "outside", "filebeat.conf")
+	writeTestConfiguration(t, outside)
+
+	link := filepath.Join(ctx.UserConfig.CollectorConfigurationDirectory, "config-2")
+	if err := os.Symlink(filepath.Dir(outside), link); err != nil {
+		t.Fatal(err)
+	}
+
+	store.CleanupConfigurations(ctx)
+	if _, err := os.Stat(outside); err != nil {
+		t.Fatalf("files outside of the configuration directory must not be removed: %v", err)
+	}
+}
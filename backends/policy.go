@@ -0,0 +1,61 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/helpers"
+)
+
+// CheckAssignmentPolicy verifies that `collector_assignment_policy` allows the server to
+// assign this backend. Locally defined backends are always allowed.
+func (b *Backend) CheckAssignmentPolicy(context *context.Ctx) error {
+	if b.Local {
+		return nil
+	}
+	policy := context.UserConfig.CollectorAssignmentPolicy
+
+	if b.matchesAnyCollector(policy.DeniedCollectors) {
+		return fmt.Errorf("Policy violation: collector %s (%s) is denied by `collector_assignment_policy'",
+			b.CollectorName, b.CollectorId)
+	}
+	if len(policy.AllowedCollectors) > 0 && !b.matchesAnyCollector(policy.AllowedCollectors) {
+		return fmt.Errorf("Policy violation: collector %s (%s) is not allowed by `collector_assignment_policy'",
+			b.CollectorName, b.CollectorId)
+	}
+	if len(policy.AllowedServiceTypes) > 0 && !helpers.IsInList(b.ServiceType, policy.AllowedServiceTypes) {
+		return fmt.Errorf("Policy violation: service type %s is not allowed by `collector_assignment_policy'",
+			b.ServiceType)
+	}
+	return nil
+}
+
+func (b *Backend) matchesAnyCollector(patterns []string) bool {
+	for _, pattern := range patterns {
+		for _, value := range []string{b.CollectorName, b.CollectorId} {
+			if value == "" {
+				continue
+			}
+			if match, err := filepath.Match(pattern, value); (err == nil && match) || pattern == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+func TestCheckAssignmentPolicy(t *testing.T) {
+	ctx := &context.Ctx{UserConfig: &cfgfile.SidecarConfig{
+		CollectorAssignmentPolicy: cfgfile.AssignmentPolicy{
+			AllowedCollectors:   []string{"filebeat", "winlog*", "5f0d"},
+			DeniedCollectors:    []string{"winlogbeat-legacy"},
+			AllowedServiceTypes: []string{"exec"},
+		},
+	}}
+
+	cases := []struct {
+		backend Backend
+		allowed bool
+	}{
+		{Backend{CollectorId: "1", CollectorName: "filebeat", ServiceType: "exec"}, true},
+		{Backend{CollectorId: "2", CollectorName: "winlogbeat", ServiceType: "exec"}, true},
+		{Backend{CollectorId: "5f0d", CollectorName: "custom", ServiceType: "exec"}, true},
+		{Backend{CollectorId: "3", CollectorName: "winlogbeat-legacy", ServiceType: "exec"}, false},
+		{Backend{CollectorId: "4", CollectorName: "nxlog", ServiceType: "exec"}, false},
+		{Backend{CollectorId: "1", CollectorName: "filebeat", ServiceType: "svc"}, false},
+		{Backend{CollectorId: "4", CollectorName: "nxlog", ServiceType: "svc", Local: true}, true},
+	}
+	for _, c := range cases {
+		err := c.backend.CheckAssignmentPolicy(ctx)
+		if c.allowed && err != nil {
+			t.Errorf("%s/%s should be allowed: %v", c.backend.CollectorName, c.backend.ServiceType, err)
+		}
+		if !c.allowed && err == nil {
+			t.Errorf("%s/%s should be refused", c.backend.CollectorName, c.backend.ServiceType)
+		}
+	}
+}
+
+func TestCheckAssignmentPolicyEmpty(t *testing.T) {
+	ctx := &context.Ctx{UserConfig: &cfgfile.SidecarConfig{}}
+	backend := Backend{CollectorId: "1", CollectorName: "filebeat", ServiceType: "exec"}
+	if err := backend.CheckAssignmentPolicy(ctx); err != nil {
+		t.Fatalf("empty policy should allow every collector: %v", err)
+	}
+}
@@ -16,6 +16,7 @@
 package backends
 
 import (
+	"github.com/Graylog2/collector-sidecar/assignments"
 	"github.com/Graylog2/collector-sidecar/helpers"
 	"github.com/Graylog2/collector-sidecar/logger"
 )
@@ -23,11 +24,15 @@ import (
 var (
 	log = logger.Log()
 	// global store of available backends, like reported from Graylog server
-	Store = &backendStore{backends: make(map[string]*Backend)}
+	Store = &backendStore{
+		backends:               make(map[assignments.BackendKey]*Backend),
+		orphanedConfigurations: make(map[string]*orphanedConfiguration),
+	}
 )
 
 type backendStore struct {
-	backends map[string]*Backend
+	backends               map[assignments.BackendKey]*Backend
+	orphanedConfigurations map[string]*orphanedConfiguration
 }
 
 func (bs *backendStore) SetBackend(backend Backend) {
@@ -56,15 +61,15 @@ func (bs *backendStore) GetBackendsForCollectorId(collectorId string) []*Backend
 	return backends
 }
 
-func (bs *backendStore) GetBackend(id string) *Backend {
+func (bs *backendStore) GetBackend(id assignments.BackendKey) *Backend {
 	return bs.backends[id]
 }
 
 func (bs *backendStore) Update(backends []Backend) {
 	if len(backends) != 0 {
-		var activeIds []string
+		activeIds := make(map[assignments.BackendKey]bool)
 		for _, backend := range backends {
-			activeIds = append(activeIds, backend.Id)
+			activeIds[backend.Id] = true
 
 			// add new backend
 			if bs.backends[backend.Id] == nil {
@@ -78,13 +83,13 @@ func (bs *backendStore) Update(backends []Backend) {
 		}
 		bs.Cleanup(activeIds)
 	} else {
-		bs.Cleanup([]string{})
+		bs.Cleanup(map[assignments.BackendKey]bool{})
 	}
 }
 
-func (bs *backendStore) Cleanup(validBackendIds []string) {
+func (bs *backendStore) Cleanup(validBackendIds map[assignments.BackendKey]bool) {
 	for _, backend := range bs.backends {
-		if !helpers.IsInList(backend.Id, validBackendIds) {
+		if !validBackendIds[backend.Id] {
 			log.Debug("Cleaning up backend: " + backend.Name)
 			delete(bs.backends, backend.Id)
 		}
@@ -17,6 +17,7 @@ package backends
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 
@@ -25,21 +26,45 @@ import (
 	"github.com/Graylog2/collector-sidecar/helpers"
 )
 
-func (b *Backend) render() []byte {
+var errRejectedByPolicy = errors.New("configuration rejected by policy")
+
+// render resolves the template variables, b.Template itself always keeps the unresolved references
+func (b *Backend) render(template string, context *context.Ctx) ([]byte, error) {
+	template, err := expandVariables(template, context)
+	if err != nil {
+		return nil, err
+	}
 	var result bytes.Buffer
-	result.WriteString(b.Template)
+	result.WriteString(template)
 
-	return helpers.ConvertLineBreak(result.Bytes())
+	return helpers.ConvertLineBreak(result.Bytes()), nil
 }
 
-func (b *Backend) renderToFile(context *context.Ctx) error {
+func (b *Backend) renderToFile(template string, context *context.Ctx) error {
+	if err := b.CheckIdentifiers(); err != nil {
+		b.SetStatusLogErrorf("Refusing to write configuration: %s", err)
+		return err
+	}
+	if err := b.CheckAssignmentPolicy(context); err != nil {
+		b.SetStatusLogErrorf("%s", err)
+		return err
+	}
 	if !b.CheckConfigPathAgainstAccesslist(context) {
 		err := fmt.Errorf("Configuration path violates `collector_binaries_accesslist' config option.")
-		b.SetStatusLogErrorf(err.Error())
+		b.SetStatusLogErrorf("%s", err)
 		return err
 	}
-	stringConfig := b.render()
-	err := common.CreatePathToFile(b.ConfigurationPath)
+	stringConfig, err := b.render(template, context)
+	if err != nil {
+		b.SetStatusLogErrorf("Failed to resolve template variables: %s", err)
+		return err
+	}
+	// the policy sees the configuration exactly as it is written, including resolved variables
+	if err := context.ConfigurationPolicy.Check(b.CollectorName, string(stringConfig)); err != nil {
+		b.SetStatusLogErrorf("Configuration rejected by policy: %s", err)
+		return fmt.Errorf("%w: %v", errRejectedByPolicy, err)
+	}
+	err = common.CreatePathToFile(b.ConfigurationPath)
 	if err != nil {
 		return err
 	}
@@ -47,13 +72,20 @@ func (b *Backend) renderToFile(context *context.Ctx) error {
 	return err
 }
 
+// RenderOnChange writes a changed template. b.Template is only updated after the file was written,
+// a failed render, e.g. of a temporarily unavailable secret, is retried with the next update.
+// A template rejected by the configuration policy is remembered to not check it again until it
+// changes, the collector keeps running with the last compliant configuration.
 func (b *Backend) RenderOnChange(changedBackend Backend, context *context.Ctx) bool {
 	if b.Template != changedBackend.Template {
 		log.Infof("[%s] Configuration change detected, rewriting configuration file.", b.Name)
-		b.Template = changedBackend.Template
-		if err := b.renderToFile(context); err != nil {
+		if err := b.renderToFile(changedBackend.Template, context); err != nil {
+			if errors.Is(err, errRejectedByPolicy) {
+				b.Template = changedBackend.Template
+			}
 			return false
 		}
+		b.Template = changedBackend.Template
 		return true
 	}
 	return false
@@ -17,6 +17,8 @@ package backends
 
 import (
 	"fmt"
+
+	"github.com/Graylog2/collector-sidecar/secrets"
 	"github.com/Graylog2/collector-sidecar/system"
 )
 
@@ -27,18 +29,19 @@ const (
 	StatusStopped int = 3
 )
 
+// status messages may contain collector output, resolved secrets are redacted
 func (b *Backend) SetStatus(state int, message string, verbose string) {
-	b.backendStatus.Set(state, message, verbose)
+	b.backendStatus.Set(state, secrets.Redact(message), secrets.Redact(verbose))
 }
 
 func (b *Backend) SetVerboseStatus(verbose string) {
-	b.backendStatus.VerboseMessage = verbose
+	b.backendStatus.VerboseMessage = secrets.Redact(verbose)
 }
 
 func (b *Backend) SetStatusLogErrorf(format string, args ...interface{}) error {
 	b.SetStatus(StatusError, fmt.Sprintf(format, args...), "")
 	log.Errorf(fmt.Sprintf("[%s] ", b.Name)+format, args...)
-	return fmt.Errorf(format, args)
+	return fmt.Errorf(format, args...)
 }
 
 func (b *Backend) Status() system.VerboseStatus {
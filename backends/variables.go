@@ -0,0 +1,90 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/secrets"
+)
+
+// ${namespace:key} references in templates are resolved by the sidecar when the configuration is
+// written, other ${...} expressions are left to the server and the collector.
+var templateVariable = regexp.MustCompile(`\$\{([a-z]+):([^}]*)\}`)
+
+// VariableResolver returns the value of a template variable within its namespace
+type VariableResolver func(context *context.Ctx, key string) (string, error)
+
+var variableRegistry = map[string]VariableResolver{
+	"secret":    secretVariable,
+	"label":     labelVariable,
+	"inventory": inventoryVariable,
+}
+
+// expandVariables resolves all known variables in a single pass, resolved values are never expanded again
+func expandVariables(template string, context *context.Ctx) (string, error) {
+	var expandErr error
+	result := templateVariable.ReplaceAllStringFunc(template, func(reference string) string {
+		match := templateVariable.FindStringSubmatch(reference)
+		resolve, ok := variableRegistry[match[1]]
+		if !ok || expandErr != nil {
+			return reference
+		}
+		value, err := resolve(context, match[2])
+		if err != nil {
+			expandErr = err
+			return reference
+		}
+		return value
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return result, nil
+}
+
+func secretVariable(context *context.Ctx, key string) (string, error) {
+	return context.Secrets.Resolve(key)
+}
+
+func labelVariable(context *context.Ctx, key string) (string, error) {
+	value, ok := context.UserConfig.Labels[key]
+	if !ok {
+		return "", fmt.Errorf("label %q is not defined", key)
+	}
+	return value, nil
+}
+
+func inventoryVariable(context *context.Ctx, key string) (string, error) {
+	value, ok := context.Inventory.Variables()[key]
+	if !ok {
+		return "", fmt.Errorf("unknown inventory variable %q", key)
+	}
+	return value, nil
+}
+
+// RedactSecretVariables replaces all ${secret:...} references of a template, the result can be
+// shown without resolving a single secret
+func RedactSecretVariables(template string) string {
+	return templateVariable.ReplaceAllStringFunc(template, func(reference string) string {
+		if templateVariable.FindStringSubmatch(reference)[1] == "secret" {
+			return secrets.Redacted
+		}
+		return reference
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/policy"
+	"github.com/Graylog2/collector-sidecar/secrets"
+	"github.com/Graylog2/collector-sidecar/system"
+)
+
+func TestExpandVariables(t *testing.T) {
+	t.Setenv("TEST_SECRET_password", "${label:team}")
+	ctx := &context.Ctx{
+		UserConfig: &cfgfile.SidecarConfig{Labels: map[string]string{"datacenter": "fra1", "team": "ops"}},
+		Secrets:    secrets.NewResolver(&secrets.EnvProvider{Prefix: "TEST_SECRET_"}),
+		Inventory:  system.NewInventory(),
+	}
+
+	result, err := expandVariables("dc: ${label:datacenter}\npassword: ${secret:password}\nnode: ${sidecar.nodeId}\nenv: ${env:HOME}\n", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// resolved values are not expanded again, unknown namespaces are left untouched
+	expected := "dc: fra1\npassword: ${label:team}\nnode: ${sidecar.nodeId}\nenv: ${env:HOME}\n"
+	if result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+
+	if _, err := expandVariables("${label:missing}", ctx); err == nil {
+		t.Fatal("undefined label should fail")
+	}
+
+	result, err = expandVariables("arch: ${inventory:architecture}", ctx)
+	if err != nil || result != "arch: "+runtime.GOARCH {
+		t.Fatalf("expected inventory architecture, got %q, %v", result, err)
+	}
+	if _, err := expandVariables("${inventory:missing}", ctx); err == nil {
+		t.Fatal("unknown inventory variable should fail")
+	}
+}
+
+func TestRedactSecretVariables(t *testing.T) {
+	result := RedactSecretVariables("password: ${secret:password}\ndc: ${label:datacenter}\nnode: ${sidecar.nodeId}\n")
+	expected := "password: [REDACTED]\ndc: ${label:datacenter}\nnode: ${sidecar.nodeId}\n"
+	if result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestExpandSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "logstash_password"), []byte("s3cr3t-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET_api_key", "s3cr3t-from-env")
+	ctx := &context.Ctx{Secrets: secrets.NewResolver(&secrets.FileProvider{Directory: dir}, &secrets.EnvProvider{Prefix: "TEST_SECRET_"})}
+
+	result, err := expandVariables("password: ${secret:logstash_password}\nkey: ${secret:api_key}\nnode: ${sidecar.nodeId}\n", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "password: s3cr3t-from-file\nkey: s3cr3t-from-env\nnode: ${sidecar.nodeId}\n"
+	if result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+	if redactedText := secrets.Redact("validation failed for s3cr3t-from-file and s3cr3t-from-env"); strings.Contains(redactedText, "s3cr3t") {
+		t.Fatalf("secret values were not redacted: %s", redactedText)
+	}
+
+	for _, template := range []string{"${secret:missing}", "${secret:../etc/passwd}", "${secret:}"} {
+		if _, err := expandVariables(template, ctx); err == nil {
+			t.Errorf("expected %q to fail", template)
+		}
+	}
+	unconfigured := &context.Ctx{}
+	if _, err := expandVariables("${secret:name}", unconfigured); err == nil {
+		t.Error("expected reference without providers to fail")
+	}
+	if result, err := expandVariables("no references", unconfigured); err != nil || result != "no references" {
+		t.Errorf("template without references should not change: %q, %v", result, err)
+	}
+}
+
+func TestRenderOnChangeRetriesFailedRender(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &context.Ctx{
+		UserConfig: &cfgfile.SidecarConfig{CollectorConfigurationDirectory: dir},
+		Secrets:    secrets.NewResolver(&secrets.EnvProvider{Prefix: "TEST_RENDER_"}),
+	}
+	backend := &Backend{Name: "filebeat", ConfigId: "1234", ConfigurationPath: filepath.Join(dir, "1234", "filebeat.conf")}
+	template := "password: ${secret:password}\n"
+
+	// the secret is not available yet
+	if backend.RenderOnChange(Backend{Template: template}, ctx) {
+		t.Fatal("render should fail without the secret")
+	}
+	if backend.Template != "" {
+		t.Fatalf("failed template was stored: %q", backend.Template)
+	}
+
+	t.Setenv("TEST_RENDER_password", "available-now")
+	if !backend.RenderOnChange(Backend{Template: template}, ctx) {
+		t.Fatal("render should be retried")
+	}
+	content, err := os.ReadFile(backend.ConfigurationPath)
+	if err != nil || !strings.Contains(string(content), "password: available-now") {
+		t.Fatalf("unexpected configuration %q, %v", content, err)
+	}
+}
+
+func TestRenderOnChangeChecksRenderedConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.yml")
+	if err := os.WriteFile(policyPath, []byte("rules:\n  - allowed_output_hosts: [\"graylog.example.org\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configurationPolicy, err := policy.Load(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_POLICY_host", "evil.example.com")
+	ctx := &context.Ctx{
+		UserConfig:          &cfgfile.SidecarConfig{CollectorConfigurationDirectory: dir},
+		Secrets:             secrets.NewResolver(&secrets.EnvProvider{Prefix: "TEST_POLICY_"}),
+		ConfigurationPolicy: configurationPolicy,
+	}
+	backend := &Backend{Name: "filebeat", CollectorName: "filebeat", ConfigId: "1234", ConfigurationPath: filepath.Join(dir, "1234", "filebeat.conf")}
+
+	// the template itself has no disallowed host, the resolved secret has
+	template := "output.logstash:\n  hosts: [\"${secret:host}:5044\"]\n"
+	if backend.RenderOnChange(Backend{Template: template}, ctx) {
+		t.Fatal("rendered configuration should be rejected")
+	}
+	if _, err := os.Stat(backend.ConfigurationPath); !os.IsNotExist(err) {
+		t.Fatalf("rejected configuration was written: %v", err)
+	}
+	// the rejected template is not checked again until it changes
+	if backend.Template != template {
+		t.Fatalf("rejected template was not remembered: %q", backend.Template)
+	}
+}
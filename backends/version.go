@@ -0,0 +1,147 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/flynn-archive/go-shlex"
+
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/helpers"
+)
+
+// the first version-like string of the output, e.g. "8.11.1" from "filebeat version 8.11.1 (amd64), libbeat 8.11.1"
+var versionPattern = regexp.MustCompile(`\d+\.\d+(\.\d+)*([-+~][0-9A-Za-z][0-9A-Za-z.-]*)?`)
+
+var (
+	versionCacheMutex sync.Mutex
+	// detected versions by executable and version parameters
+	versionCache = make(map[string]detectedVersion)
+)
+
+type detectedVersion struct {
+	fingerprint string
+	version     string
+}
+
+// Version returns the collector version detected at the last start
+func (b *Backend) Version() string {
+	return b.version
+}
+
+// DetectVersion runs the version command of the collector. The command is only executed again
+// if the executable changed since the last detection.
+func (b *Backend) DetectVersion(context *context.Ctx) {
+	if b.VersionParameters == "" {
+		return
+	}
+	fingerprint, err := executableFingerprint(b.ExecutablePath)
+	if err != nil {
+		b.version = ""
+		return
+	}
+	key := b.ExecutablePath + "\x00" + b.VersionParameters
+
+	versionCacheMutex.Lock()
+	cached, ok := versionCache[key]
+	versionCacheMutex.Unlock()
+	if ok && cached.fingerprint == fingerprint {
+		b.version = cached.version
+		return
+	}
+
+	output, err := b.runVersionCommand(context.UserConfig.CollectorValidationTimeout)
+	version := ""
+	if err != nil {
+		log.Warnf("[%s] Failed to detect collector version: %s", b.Name, err)
+	} else if version = ParseVersion(output); version == "" {
+		log.Warnf("[%s] Version command returned no version: %q", b.Name, output)
+	} else {
+		log.Infof("[%s] Detected collector version %s", b.Name, version)
+	}
+	b.version = version
+
+	versionCacheMutex.Lock()
+	versionCache[key] = detectedVersion{fingerprint: fingerprint, version: version}
+	versionCacheMutex.Unlock()
+}
+
+// ParseVersion extracts the version number from the output of a version command
+func ParseVersion(output string) string {
+	return versionPattern.FindString(output)
+}
+
+// a link switched to another binary or a replaced file changes the fingerprint
+func executableFingerprint(path string) (string, error) {
+	path, err := exec.LookPath(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d:%d", resolved, info.Size(), info.ModTime().UnixNano()), nil
+}
+
+func (b *Backend) runVersionCommand(timeout time.Duration) (string, error) {
+	var err error
+	var quotedArgs []string
+	if runtime.GOOS == "windows" {
+		quotedArgs = helpers.CommandLineToArgv(b.VersionParameters)
+	} else {
+		quotedArgs, err = shlex.Split(b.VersionParameters)
+	}
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(b.ExecutablePath, quotedArgs...)
+	var combinedOutputBuffer bytes.Buffer
+	cmd.Stdout = &combinedOutputBuffer
+	cmd.Stderr = &combinedOutputBuffer
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return "", fmt.Errorf("timeout <%v> reached", timeout)
+	case err := <-done:
+		// some collectors exit with an error after printing their version
+		if err != nil && combinedOutputBuffer.Len() == 0 {
+			return "", err
+		}
+		return combinedOutputBuffer.String(), nil
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package backends
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := map[string]string{
+		"filebeat version 8.11.1 (amd64), libbeat 8.11.1 [7d7c5a2 built 2023-11-09]": "8.11.1",
+		"nxlog-ce-3.2.2329":                      "3.2.2329",
+		"Winlogbeat version 7.17.0-SNAPSHOT (x)": "7.17.0-SNAPSHOT",
+		"v1.2":                                   "1.2",
+		"no version here":                        "",
+	}
+	for output, expected := range tests {
+		if version := ParseVersion(output); version != expected {
+			t.Errorf("expected %q for %q, got %q", expected, output, version)
+		}
+	}
+}
+
+func TestDetectVersionRunsAfterBinaryChanges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as collector")
+	}
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "collector")
+	calls := filepath.Join(dir, "calls")
+	writeCollector := func(version string) {
+		script := "#!/bin/sh\necho x >> " + calls + "\necho \"collector version " + version + "\"\n"
+		if err := os.WriteFile(executable, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	countCalls := func() int {
+		content, _ := os.ReadFile(calls)
+		return strings.Count(string(content), "x")
+	}
+	ctx := &context.Ctx{UserConfig: &cfgfile.SidecarConfig{CollectorValidationTimeout: 10 * time.Second}}
+	backend := &Backend{Name: "collector", ExecutablePath: executable, VersionParameters: "version"}
+
+	writeCollector("1.0.0")
+	backend.DetectVersion(ctx)
+	backend.DetectVersion(ctx)
+	if backend.Version() != "1.0.0" || countCalls() != 1 {
+		t.Fatalf("expected version 1.0.0 from one call, got %q from %d calls", backend.Version(), countCalls())
+	}
+
+	// a new binary of a different size is detected again
+	writeCollector("1.10.0")
+	backend.DetectVersion(ctx)
+	if backend.Version() != "1.10.0" || countCalls() != 2 {
+		t.Fatalf("expected version 1.10.0 from two calls, got %q from %d calls", backend.Version(), countCalls())
+	}
+}
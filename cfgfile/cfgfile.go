@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -47,10 +48,53 @@ func Read(sidecarConfig *SidecarConfig, path string) error {
 		path = configurationFile
 	}
 
+	return readYaml(sidecarConfig, path, true)
+}
+
+// ReadLocalDefinitions reads all `*.yml` and `*.yaml` files of a drop-in directory in
+// lexical order. A missing directory is not an error.
+func ReadLocalDefinitions(dir string) ([]LocalDefinitions, error) {
+	var definitions []LocalDefinitions
+	if dir == "" {
+		return definitions, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return definitions, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("[ConfigFile] Failed to read directory %s: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		if entry.IsDir() || (extension != ".yml" && extension != ".yaml") {
+			continue
+		}
+		localDefinitions := LocalDefinitions{}
+		if err := readYaml(&localDefinitions, filepath.Join(dir, entry.Name()), true); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, localDefinitions)
+	}
+	return definitions, nil
+}
+
+// ReadConfigurationPolicy reads the rules of a `configuration_policy_file`.
+// Environment variables are not expanded, the rules may contain regular expressions.
+func ReadConfigurationPolicy(path string) (*ConfigurationPolicy, error) {
+	policy := &ConfigurationPolicy{}
+	if err := readYaml(policy, path, false); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func readYaml(to interface{}, path string, expandVariables bool) error {
 	configfile, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("[ConfigFile] Failed to read %s: %v. Exiting.", path, err)
 	}
+	defer configfile.Close()
 
 	filecontent := []byte{}
 	// append configuration, but strip away possible yaml doc separators
@@ -61,7 +105,9 @@ func Read(sidecarConfig *SidecarConfig, path string) error {
 			filecontent = append(filecontent, []byte(line+"\n")...)
 		}
 	}
-	filecontent = expandEnv(filecontent)
+	if expandVariables {
+		filecontent = expandEnv(filecontent)
+	}
 
 	// SidecarConfig implements Initializer, so we don't have to construct it ourselves here.
 	// The platform-specific defaults will be applied by ucfg
@@ -70,7 +116,7 @@ func Read(sidecarConfig *SidecarConfig, path string) error {
 		return fmt.Errorf("[ConfigFile] YAML config parsing failed on %s: %v. Exiting.", path, err)
 	}
 
-	err = config.Unpack(sidecarConfig, ucfg.PathSep("."))
+	err = config.Unpack(to, ucfg.PathSep("."))
 	if err != nil {
 		return fmt.Errorf("[ConfigFile] Failed to apply config %s: %v. Exiting. ", path, err)
 	}
@@ -15,51 +15,237 @@
 
 package cfgfile
 
-import "time"
+import (
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/common"
+)
 
 type SidecarConfig struct {
-	ServerUrl                        string        `config:"server_url"`
-	ServerApiToken                   string        `config:"server_api_token"`
-	TlsSkipVerify                    bool          `config:"tls_skip_verify"`
-	NodeName                         string        `config:"node_name"`
-	NodeId                           string        `config:"node_id"`
-	CachePath                        string        `config:"cache_path"`
-	LogPath                          string        `config:"log_path"`
-	CollectorValidationTimeoutString string        `config:"collector_validation_timeout"`
-	CollectorValidationTimeout       time.Duration // set from CollectorValidationTimeoutString
-	CollectorConfigurationDirectory  string        `config:"collector_configuration_directory"`
-	CollectorShutdownTimeoutString   string        `config:"collector_shutdown_timeout"`
-	CollectorShutdownTimeout         time.Duration // set from CollectorShutdownTimeoutString
-	LogRotateMaxFileSizeString       string        `config:"log_rotate_max_file_size"`
-	LogRotateMaxFileSize             int64         // set from LogRotateMaxFileSizeString
-	LogRotateKeepFiles               int           `config:"log_rotate_keep_files"`
-	UpdateInterval                   int           `config:"update_interval"`
-	SendStatus                       bool          `config:"send_status"`
-	ListLogFiles                     []string      `config:"list_log_files"`
-	CollectorBinariesWhitelist       []string      `config:"collector_binaries_whitelist"`
-	CollectorBinariesAccesslist      []string      `config:"collector_binaries_accesslist,replace"`
-	Tags                             []string      `config:"tags"`
-	WindowsDriveRange                string        `config:"windows_drive_range"`
+	ServerUrl                                      string            `config:"server_url"`
+	ServerApiToken                                 string            `config:"server_api_token"`
+	ServerApiTokenFile                             string            `config:"server_api_token_file"`
+	ServerApiTokenCommand                          string            `config:"server_api_token_command"`
+	ServerApiTokenRefreshIntervalString            string            `config:"server_api_token_refresh_interval"`
+	ServerApiTokenRefreshInterval                  time.Duration     // set from ServerApiTokenRefreshIntervalString
+	TlsSkipVerify                                  bool              `config:"tls_skip_verify"`
+	NodeName                                       string            `config:"node_name"`
+	NodeId                                         string            `config:"node_id"`
+	CachePath                                      string            `config:"cache_path"`
+	LogPath                                        string            `config:"log_path"`
+	CollectorValidationTimeoutString               string            `config:"collector_validation_timeout"`
+	CollectorValidationTimeout                     time.Duration     // set from CollectorValidationTimeoutString
+	CollectorConfigurationDirectory                string            `config:"collector_configuration_directory"`
+	CollectorShutdownTimeoutString                 string            `config:"collector_shutdown_timeout"`
+	CollectorShutdownTimeout                       time.Duration     // set from CollectorShutdownTimeoutString
+	CollectorConfigurationCleanup                  bool              `config:"collector_configuration_cleanup"`
+	CollectorConfigurationCleanupGracePeriodString string            `config:"collector_configuration_cleanup_grace_period"`
+	CollectorConfigurationCleanupGracePeriod       time.Duration     // set from CollectorConfigurationCleanupGracePeriodString
+	CollectorConfigurationCleanupDryRun            bool              `config:"collector_configuration_cleanup_dry_run"`
+	CollectorDiagnostics                           Diagnostics       `config:"collector_diagnostics"`
+	CollectorActionTimeoutString                   string            `config:"collector_action_timeout"`
+	CollectorActionTimeout                         time.Duration     // set from CollectorActionTimeoutString
+	LogRotateMaxFileSizeString                     string            `config:"log_rotate_max_file_size"`
+	LogRotateMaxFileSize                           int64             // set from LogRotateMaxFileSizeString
+	LogRotateKeepFiles                             int               `config:"log_rotate_keep_files"`
+	UpdateInterval                                 int               `config:"update_interval"`
+	SendStatus                                     bool              `config:"send_status"`
+	PrimaryIp                                      string            `config:"primary_ip"`
+	MetricGroups                                   []string          `config:"metric_groups,replace"`
+	DiskUsage                                      DiskUsage         `config:"disk_usage"`
+	ListLogFiles                                   []string          `config:"list_log_files"`
+	LogFileDiscovery                               LogFileDiscovery  `config:"log_file_discovery"`
+	CollectorBinariesWhitelist                     []string          `config:"collector_binaries_whitelist"`
+	CollectorBinariesAccesslist                    []string          `config:"collector_binaries_accesslist,replace"`
+	Tags                                           []string          `config:"tags"`
+	TagsDirectory                                  string            `config:"tags_directory"`
+	TagsEnvPrefix                                  string            `config:"tags_env_prefix"`
+	TagsCommands                                   []string          `config:"tags_commands"`
+	Labels                                         map[string]string `config:"labels"`
+	SendInventory                                  bool              `config:"send_inventory"`
+	InventoryTags                                  bool              `config:"inventory_tags"`
+	WindowsDriveRange                              string            `config:"windows_drive_range"`
+	Standalone                                     bool              `config:"standalone"`
+	LocalDefinitionsDirectory                      string            `config:"local_definitions_directory"`
+	LocalDefinitions                               `config:",inline"`
+	CollectorAssignmentPolicy                      AssignmentPolicy `config:"collector_assignment_policy"`
+	ConfigurationPolicyFile                        string           `config:"configuration_policy_file"`
+	SecretProviders                                SecretProviders  `config:"secret_providers"`
+	SelfUpdate                                     SelfUpdate       `config:"self_update"`
+	CollectorInstall                               CollectorInstall `config:"collector_install"`
+}
+
+// SecretProviders configures the local sources of `${secret:name}` references.
+// Providers are asked in the order directory, environment, command.
+type SecretProviders struct {
+	Directory string `config:"directory"`
+	EnvPrefix string `config:"env_prefix"`
+	Command   string `config:"command"`
+}
+
+// SelfUpdate configures updates of the sidecar binary advertised by the server or a manifest URL
+type SelfUpdate struct {
+	Enabled               bool          `config:"enabled"`
+	ManifestUrl           string        `config:"manifest_url"`
+	PublicKey             string        `config:"public_key"`
+	CheckIntervalString   string        `config:"check_interval"`
+	CheckInterval         time.Duration // set from CheckIntervalString
+	RollbackTimeoutString string        `config:"rollback_timeout"`
+	RollbackTimeout       time.Duration // set from RollbackTimeoutString
+	AllowDowngrade        bool          `config:"allow_downgrade"`
+}
+
+// CollectorInstall configures collector binaries the sidecar installs from a manifest
+type CollectorInstall struct {
+	Enabled             bool          `config:"enabled"`
+	ManifestUrl         string        `config:"manifest_url"`
+	PublicKey           string        `config:"public_key"`
+	Directory           string        `config:"directory"`
+	CheckIntervalString string        `config:"check_interval"`
+	CheckInterval       time.Duration // set from CheckIntervalString
+}
+
+// AssignmentPolicy limits which collectors the server may assign to this node.
+// Collectors are matched by name or ID, wildcards are supported.
+type AssignmentPolicy struct {
+	AllowedCollectors   []string `config:"allowed_collectors,replace"`
+	DeniedCollectors    []string `config:"denied_collectors,replace"`
+	AllowedServiceTypes []string `config:"allowed_service_types,replace"`
+}
+
+// Diagnostics configures the "diagnostics" collector action
+type Diagnostics struct {
+	Enabled       bool   `config:"enabled"`
+	MaxSizeString string `config:"max_size"`
+	MaxSize       int64  // set from MaxSizeString
+}
+
+// DiskUsage configures which filesystems are reported and when they are considered full
+type DiskUsage struct {
+	WarningThreshold   float64  `config:"warning_threshold"`
+	CriticalThreshold  float64  `config:"critical_threshold"`
+	IncludeMountPoints []string `config:"include_mount_points,replace"`
+	ExcludeMountPoints []string `config:"exclude_mount_points,replace"`
+	IncludeFsTypes     []string `config:"include_fs_types,replace"`
+	ExcludeFsTypes     []string `config:"exclude_fs_types,replace"`
+}
+
+// LogFileDiscovery limits the file list of `list_log_files`
+type LogFileDiscovery struct {
+	MaxDepth              int           `config:"max_depth"`
+	IncludePatterns       []string      `config:"include_patterns,replace"`
+	ExcludePatterns       []string      `config:"exclude_patterns,replace"`
+	MaxEntries            int           `config:"max_entries"`
+	RefreshIntervalString string        `config:"refresh_interval"`
+	RefreshInterval       time.Duration // set from RefreshIntervalString
+	FileDetails           bool          `config:"file_details"`
+	FileDetailsUser       string        `config:"file_details_user"`
+}
+
+// LocalDefinitions describes collectors, configurations and assignments which are
+// managed on the host itself instead of being fetched from the server.
+type LocalDefinitions struct {
+	Collectors     []LocalCollector     `config:"collectors"`
+	Configurations []LocalConfiguration `config:"configurations"`
+	Assignments    []LocalAssignment    `config:"assignments"`
+}
+
+type LocalCollector struct {
+	Id                   string `config:"id"`
+	Name                 string `config:"name"`
+	ServiceType          string `config:"service_type"`
+	ExecutablePath       string `config:"executable_path"`
+	ExecuteParameters    string `config:"execute_parameters"`
+	ValidationParameters string `config:"validation_parameters"`
+	VersionParameters    string `config:"version_parameters"`
+}
+
+type LocalConfiguration struct {
+	Id           string `config:"id"`
+	TemplateFile string `config:"template_file"`
+}
+
+type LocalAssignment struct {
+	CollectorId     string `config:"collector_id"`
+	ConfigurationId string `config:"configuration_id"`
+}
+
+// ConfigurationPolicy is the content of `configuration_policy_file`
+type ConfigurationPolicy struct {
+	Rules []ConfigurationPolicyRule `config:"rules"`
+}
+
+// ConfigurationPolicyRule applies to all collectors matching one of the name patterns,
+// or to every collector if no pattern is given.
+type ConfigurationPolicyRule struct {
+	Collectors         []string `config:"collectors"`
+	DenyPatterns       []string `config:"deny_patterns"`
+	RequirePatterns    []string `config:"require_patterns"`
+	AllowedOutputHosts []string `config:"allowed_output_hosts"`
 }
 
 func (config *SidecarConfig) InitDefaults() {
 	config.ServerUrl = "http://127.0.0.1:9000/api/"
 	config.ServerApiToken = ""
+	config.ServerApiTokenRefreshIntervalString = "1m"
 	config.TlsSkipVerify = false
 	config.CollectorValidationTimeoutString = "1m"
 	config.CollectorShutdownTimeoutString = "10s"
+	config.CollectorActionTimeoutString = "1m"
+	config.CollectorConfigurationCleanup = false
+	config.CollectorConfigurationCleanupGracePeriodString = "1h"
+	config.CollectorConfigurationCleanupDryRun = false
+	config.CollectorDiagnostics = Diagnostics{
+		Enabled:       true,
+		MaxSizeString: "64KiB",
+	}
 	config.LogRotateMaxFileSizeString = "10MiB"
 	config.LogRotateKeepFiles = 10
 	config.UpdateInterval = 10
 	config.SendStatus = true
+	config.MetricGroups = []string{}
+	config.DiskUsage = DiskUsage{
+		WarningThreshold:   75,
+		CriticalThreshold:  0,
+		IncludeMountPoints: []string{},
+		ExcludeMountPoints: []string{},
+		IncludeFsTypes:     []string{},
+		// pseudo and container filesystems
+		ExcludeFsTypes: []string{"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs", "debugfs",
+			"devpts", "devtmpfs", "efivarfs", "fuse.lxcfs", "fusectl", "hugetlbfs", "mqueue", "nsfs", "overlay",
+			"proc", "pstore", "ramfs", "rpc_pipefs", "securityfs", "selinuxfs", "squashfs", "sysfs", "tmpfs",
+			"tracefs"},
+	}
 	config.ListLogFiles = []string{}
+	config.LogFileDiscovery = LogFileDiscovery{
+		MaxDepth:              0,
+		IncludePatterns:       []string{},
+		ExcludePatterns:       []string{},
+		MaxEntries:            10000,
+		RefreshIntervalString: "1m",
+		FileDetails:           false,
+		FileDetailsUser:       "",
+	}
 	config.Tags = []string{}
+	config.SendInventory = false
+	config.InventoryTags = false
+	config.Standalone = false
+	config.SelfUpdate = SelfUpdate{
+		Enabled:               false,
+		CheckIntervalString:   "1h",
+		RollbackTimeoutString: "5m",
+		AllowDowngrade:        false,
+	}
+	config.CollectorInstall.Enabled = false
+	config.CollectorInstall.CheckIntervalString = "1h"
+	config.LocalDefinitionsDirectory = common.ConfigBasePath("sidecar.d")
 	// these unset values are overridden by the platform defaults, the rest are computed or required:
 	// NodeId: contains platform dependent path
 	// CachePath: contains platform dependent path
 	// LogPath: contains platform dependent path
 	// CollectorConfigurationDirectory: contains platform dependent path
 	// CollectorBinariesAccesslist: contains platform dependent path
+	// CollectorInstall.Directory: contains platform dependent path
 	// WindowsDriveRange: windows only
 
 	withPlatformDefaults(config)
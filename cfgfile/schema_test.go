@@ -107,3 +107,17 @@ func TestAccesslistExplicitEmpty(t *testing.T) {
 		t.Fatalf("explicit empty accesslist should stay empty, got %v", cfg.CollectorBinariesAccesslist)
 	}
 }
+
+func TestLabels(t *testing.T) {
+	cfg := unpackConfig(t, "labels:\n  datacenter: fra1\n  cost_center: \"4711\"\n")
+
+	want := map[string]string{"datacenter": "fra1", "cost_center": "4711"}
+	if len(cfg.Labels) != len(want) {
+		t.Fatalf("want labels %v, got %v", want, cfg.Labels)
+	}
+	for key, value := range want {
+		if cfg.Labels[key] != value {
+			t.Fatalf("label %q: want %q, got %q", key, value, cfg.Labels[key])
+		}
+	}
+}
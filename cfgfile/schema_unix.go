@@ -30,6 +30,7 @@ func withPlatformDefaults(config *SidecarConfig) {
 	config.CachePath = fmt.Sprintf("/var/cache/%s", directoryName)
 	config.LogPath = fmt.Sprintf("/var/log/%s", directoryName)
 	config.CollectorConfigurationDirectory = fmt.Sprintf("/var/lib/%s/generated", directoryName)
+	config.CollectorInstall.Directory = fmt.Sprintf("/var/lib/%s/collectors", directoryName)
 	config.CollectorBinariesAccesslist = []string{
 		"/usr/bin/filebeat",
 		"/usr/bin/packetbeat",
@@ -26,6 +26,7 @@ func withPlatformDefaults(config *SidecarConfig) {
 	config.CachePath = common.ConfigBasePath("cache")
 	config.LogPath = common.ConfigBasePath("logs")
 	config.CollectorConfigurationDirectory = common.ConfigBasePath("generated")
+	config.CollectorInstall.Directory = common.ConfigBasePath("collectors")
 	config.CollectorBinariesAccesslist = []string{
 		common.ConfigBasePath("filebeat.exe"),
 		common.ConfigBasePath("winlogbeat.exe"),
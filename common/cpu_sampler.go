@@ -0,0 +1,142 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+//go:build !freebsd && !darwin && !solaris
+
+package common
+
+import (
+	"sync"
+	"time"
+
+	sigar "github.com/elastic/gosigar"
+)
+
+const (
+	cpuSampleInterval = 5 * time.Second
+	cpuSampleWindow   = 5 * time.Minute
+)
+
+var cpuSampler = &CpuSampler{}
+
+type cpuSample struct {
+	time  time.Time
+	total sigar.Cpu
+	cores []sigar.Cpu
+}
+
+// CpuSampler takes CPU times on a fixed interval and keeps them for cpuSampleWindow,
+// so averages don't depend on how often they are requested.
+type CpuSampler struct {
+	mutex   sync.Mutex
+	once    sync.Once
+	samples []cpuSample
+}
+
+// StartCpuSampler starts the background sampling, repeated calls have no effect
+func StartCpuSampler() {
+	cpuSampler.once.Do(func() {
+		cpuSampler.sample(time.Now())
+		go func() {
+			ticker := time.NewTicker(cpuSampleInterval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				cpuSampler.sample(now)
+			}
+		}()
+	})
+}
+
+func (s *CpuSampler) sample(now time.Time) {
+	total := sigar.Cpu{}
+	if err := total.Get(); err != nil {
+		log.Debug("Failed to get CPU times")
+		return
+	}
+	cores := sigar.CpuList{}
+	if err := cores.Get(); err != nil {
+		log.Debug("Failed to get per-core CPU times")
+	}
+	s.add(cpuSample{time: now, total: total, cores: cores.List})
+}
+
+func (s *CpuSampler) add(sample cpuSample) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.samples = append(s.samples, sample)
+	// keep one sample older than the window to cover it completely
+	for len(s.samples) > 2 && sample.time.Sub(s.samples[1].time) >= cpuSampleWindow {
+		s.samples = s.samples[1:]
+	}
+}
+
+// window returns the oldest sample within the duration and the latest sample
+func (s *CpuSampler) window(duration time.Duration) (*cpuSample, *cpuSample) {
+	if len(s.samples) < 2 {
+		return nil, nil
+	}
+	latest := &s.samples[len(s.samples)-1]
+	for i := range s.samples {
+		if latest.time.Sub(s.samples[i].time) <= duration && &s.samples[i] != latest {
+			return &s.samples[i], latest
+		}
+	}
+	return &s.samples[len(s.samples)-2], latest
+}
+
+// Idle returns the idle percentage over the duration, false if there are not enough samples yet
+func (s *CpuSampler) Idle(duration time.Duration) (float64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	first, latest := s.window(duration)
+	if first == nil {
+		return 0, false
+	}
+	return idlePercent(first.total, latest.total)
+}
+
+// CoreIdle returns the idle percentage of every core over the duration
+func (s *CpuSampler) CoreIdle(duration time.Duration) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	first, latest := s.window(duration)
+	if first == nil || len(first.cores) != len(latest.cores) {
+		return nil
+	}
+	result := make([]float64, 0, len(latest.cores))
+	for i := range latest.cores {
+		idle, _ := idlePercent(first.cores[i], latest.cores[i])
+		result = append(result, idle)
+	}
+	return result
+}
+
+func idlePercent(first sigar.Cpu, latest sigar.Cpu) (float64, bool) {
+	totalDelta := latest.Total() - first.Total()
+	if latest.Total() < first.Total() || totalDelta == 0 {
+		return 0, false
+	}
+	return round(float64(latest.Idle-first.Idle)/float64(totalDelta)*100, .5, 2), true
+}
+
+// GetCpuMetrics returns the averages of the background sampler
+func GetCpuMetrics() *CpuMetrics {
+	idle1, ok := cpuSampler.Idle(time.Minute)
+	if !ok {
+		return nil
+	}
+	idle5, _ := cpuSampler.Idle(5 * time.Minute)
+	return &CpuMetrics{Idle1m: idle1, Idle5m: idle5, CoresIdle1m: cpuSampler.CoreIdle(time.Minute)}
+}
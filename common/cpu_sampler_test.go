@@ -0,0 +1,98 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+//go:build !freebsd && !darwin && !solaris
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	sigar "github.com/elastic/gosigar"
+)
+
+// every sample adds 100 ticks, idle is set per step
+func addSamples(sampler *CpuSampler, start time.Time, idle []uint64) {
+	total := sigar.Cpu{}
+	for i, step := range idle {
+		total.Idle += step
+		total.User += 100 - step
+		core := total
+		core.Idle, core.User = core.Idle/2, core.User/2
+		sampler.add(cpuSample{
+			time:  start.Add(time.Duration(i) * cpuSampleInterval),
+			total: total,
+			cores: []sigar.Cpu{core, core},
+		})
+	}
+}
+
+func TestCpuSamplerNotEnoughSamples(t *testing.T) {
+	sampler := &CpuSampler{}
+	if _, ok := sampler.Idle(time.Minute); ok {
+		t.Error("Expected no value without samples")
+	}
+	addSamples(sampler, time.Now(), []uint64{50})
+	if _, ok := sampler.Idle(time.Minute); ok {
+		t.Error("Expected no value with a single sample")
+	}
+	if cores := sampler.CoreIdle(time.Minute); cores != nil {
+		t.Errorf("Expected no core values, got %v", cores)
+	}
+}
+
+func TestCpuSamplerWindow(t *testing.T) {
+	sampler := &CpuSampler{}
+	// 10 minutes of samples: 100% idle for the first 9 minutes, then 50% idle
+	steps := int(10 * time.Minute / cpuSampleInterval)
+	lastMinute := int(time.Minute / cpuSampleInterval)
+	idle := make([]uint64, steps+1)
+	for i := range idle {
+		if i > steps-lastMinute {
+			idle[i] = 50
+		} else {
+			idle[i] = 100
+		}
+	}
+	addSamples(sampler, time.Now(), idle)
+
+	if idle, ok := sampler.Idle(time.Minute); !ok || idle != 50 {
+		t.Errorf("Expected 50%% idle over 1m, got %v", idle)
+	}
+	if idle, ok := sampler.Idle(5 * time.Minute); !ok || idle != 90 {
+		t.Errorf("Expected 90%% idle over 5m, got %v", idle)
+	}
+	cores := sampler.CoreIdle(time.Minute)
+	if len(cores) != 2 || cores[0] != 50 || cores[1] != 50 {
+		t.Errorf("Expected 50%% idle for both cores, got %v", cores)
+	}
+
+	// samples older than the window are dropped
+	maxSamples := int(cpuSampleWindow/cpuSampleInterval) + 1
+	if len(sampler.samples) > maxSamples {
+		t.Errorf("Expected at most %d samples, got %d", maxSamples, len(sampler.samples))
+	}
+}
+
+func TestCpuSamplerCounterReset(t *testing.T) {
+	sampler := &CpuSampler{}
+	now := time.Now()
+	sampler.add(cpuSample{time: now, total: sigar.Cpu{Idle: 1000, User: 1000}})
+	sampler.add(cpuSample{time: now.Add(cpuSampleInterval), total: sigar.Cpu{Idle: 10, User: 10}})
+	if _, ok := sampler.Idle(time.Minute); ok {
+		t.Error("Expected no value after a counter reset")
+	}
+}
@@ -15,11 +15,79 @@
 
 package common
 
-import "time"
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
 
 type File struct {
 	Path    string    `json:"path"`
 	ModTime time.Time `json:"mod_time"`
 	Size    int64     `json:"size"`
 	IsDir   bool      `json:"is_dir"`
+	// only set with log_file_discovery.file_details
+	Readable   *bool `json:"readable,omitempty"`
+	Rotated    bool  `json:"rotated,omitempty"`
+	Compressed bool  `json:"compressed,omitempty"`
+}
+
+var (
+	// syslog.1, syslog.2.gz, messages-20240101, app.log.2024-01-01, app-2024-01-01.log.gz
+	rotatedFileName       = regexp.MustCompile(`(\.[0-9]+|[-_.]([0-9]{8}|[0-9]{4}-[0-9]{2}-[0-9]{2})(\.[A-Za-z]+)?)$`)
+	compressedExtensions  = []string{".gz", ".bz2", ".xz", ".zst", ".lz4", ".zip", ".z"}
+	compressedFileHeaders = [][]byte{
+		{0x1f, 0x8b},                     // gzip
+		{'B', 'Z', 'h'},                  // bzip2
+		{0xfd, '7', 'z', 'X', 'Z', 0x00}, // xz
+		{0x28, 0xb5, 0x2f, 0xfd},         // zstd
+		{0x04, 0x22, 0x4d, 0x18},         // lz4
+		{'P', 'K', 0x03, 0x04},           // zip
+	}
+)
+
+// isRotatedFileName recognizes the names used by logrotate and most logging frameworks for old files
+func isRotatedFileName(path string) bool {
+	name := filepath.Base(path)
+	if ext := strings.ToLower(filepath.Ext(name)); isCompressedExtension(ext) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return rotatedFileName.MatchString(name)
+}
+
+func isCompressedExtension(ext string) bool {
+	for _, compressed := range compressedExtensions {
+		if ext == compressed {
+			return true
+		}
+	}
+	return false
+}
+
+// isCompressedFile checks the file name and the magic number of the file content
+func isCompressedFile(path string) bool {
+	if isCompressedExtension(strings.ToLower(filepath.Ext(path))) {
+		return true
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, 6)
+	n, _ := io.ReadFull(file, header)
+	return hasCompressedHeader(header[:n])
+}
+
+func hasCompressedHeader(header []byte) bool {
+	for _, magic := range compressedFileHeaders {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+	return false
 }
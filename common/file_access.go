@@ -0,0 +1,110 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+//go:build !windows
+
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileAccessChecker tells if a user can read a file. Without a user name the access of the
+// sidecar process itself is checked, otherwise the permission bits of the file and all parent
+// directories are evaluated for the user and its groups. ACLs are not considered.
+type fileAccessChecker struct {
+	self     bool
+	uid      uint32
+	gids     map[uint32]bool
+	dirCache map[string]bool
+}
+
+func newFileAccessChecker(username string) (*fileAccessChecker, error) {
+	checker := &fileAccessChecker{self: username == "", dirCache: make(map[string]bool)}
+	if checker.self {
+		return checker, nil
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected user ID %q", u.Uid)
+	}
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	checker.uid = uint32(uid)
+	checker.gids = make(map[uint32]bool)
+	for _, groupId := range groupIds {
+		if gid, err := strconv.ParseUint(groupId, 10, 32); err == nil {
+			checker.gids[uint32(gid)] = true
+		}
+	}
+	return checker, nil
+}
+
+func (c *fileAccessChecker) readable(path string, info fs.FileInfo) bool {
+	if c.self {
+		return unix.Access(path, unix.R_OK) == nil
+	}
+	if !c.permitted(info, 4) {
+		return false
+	}
+	return c.traversable(filepath.Dir(path))
+}
+
+// every parent directory needs the execute permission
+func (c *fileAccessChecker) traversable(dir string) bool {
+	if result, ok := c.dirCache[dir]; ok {
+		return result
+	}
+	result := false
+	if info, err := os.Stat(dir); err == nil && c.permitted(info, 1) {
+		parent := filepath.Dir(dir)
+		result = parent == dir || c.traversable(parent)
+	}
+	c.dirCache[dir] = result
+	return result
+}
+
+// permitted checks the owner, group or other bits of the file mode, bit is 4 for read and 1 for execute
+func (c *fileAccessChecker) permitted(info fs.FileInfo, bit fs.FileMode) bool {
+	if c.uid == 0 {
+		return true
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	mode := info.Mode().Perm()
+	switch {
+	case stat.Uid == c.uid:
+		return mode&(bit<<6) != 0
+	case c.gids[stat.Gid]:
+		return mode&(bit<<3) != 0
+	}
+	return mode&bit != 0
+}
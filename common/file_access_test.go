@@ -0,0 +1,67 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+//go:build !windows
+
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestFileAccessCheckerPermissions(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "app")
+	createFiles(t, root, "app/app.log")
+	path := filepath.Join(dir, "app.log")
+	stat := func(path string) os.FileInfo {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	owner := stat(path).Sys().(*syscall.Stat_t)
+
+	// a user which is neither owner nor in the group of the file
+	other := &fileAccessChecker{uid: owner.Uid + 1000, gids: map[uint32]bool{}, dirCache: map[string]bool{}}
+	// a user in the group of the file
+	member := &fileAccessChecker{uid: owner.Uid + 1000, gids: map[uint32]bool{owner.Gid: true}, dirCache: map[string]bool{}}
+
+	// t.TempDir creates its directories with 0700
+	os.Chmod(filepath.Dir(root), 0755)
+	os.Chmod(root, 0755)
+	os.Chmod(dir, 0750)
+	os.Chmod(path, 0640)
+	if other.readable(path, stat(path)) {
+		t.Error("file should not be readable by other users")
+	}
+	if !member.readable(path, stat(path)) {
+		t.Error("file should be readable by group members")
+	}
+
+	os.Chmod(path, 0644)
+	if other.readable(path, stat(path)) {
+		t.Error("file in a closed directory should not be readable by other users")
+	}
+	os.Chmod(dir, 0755)
+	other.dirCache = map[string]bool{}
+	if !other.readable(path, stat(path)) {
+		t.Error("world readable file should be readable by other users")
+	}
+}
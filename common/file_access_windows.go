@@ -0,0 +1,42 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package common
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// fileAccessChecker tells if the sidecar process can read a file. Checking the access of
+// another user is not supported on Windows.
+type fileAccessChecker struct{}
+
+func newFileAccessChecker(username string) (*fileAccessChecker, error) {
+	if username != "" {
+		return nil, errors.New("checking the file access of another user is not supported on Windows")
+	}
+	return &fileAccessChecker{}, nil
+}
+
+func (c *fileAccessChecker) readable(path string, info fs.FileInfo) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	file.Close()
+	return true
+}
@@ -0,0 +1,243 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package common
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errMaxEntries = errors.New("maximum number of entries reached")
+
+// FileDiscoveryOptions configures which log files are listed. Paths can be directories or
+// glob patterns. A MaxDepth of 0 walks directories completely. With FileDetails, files are
+// checked for readability by FileDetailsUser, or the sidecar user if empty, and for rotation
+// and compression.
+type FileDiscoveryOptions struct {
+	Paths           []string
+	MaxDepth        int
+	IncludePatterns []string
+	ExcludePatterns []string
+	MaxEntries      int
+	RefreshInterval time.Duration
+	FileDetails     bool
+	FileDetailsUser string
+}
+
+// Validate checks the options which can't be checked when the configuration is read
+func (o FileDiscoveryOptions) Validate() error {
+	if o.FileDetails {
+		_, err := newFileAccessChecker(o.FileDetailsUser)
+		return err
+	}
+	return nil
+}
+
+// FileDiscovery caches the file list and refreshes it in the background once it is older than
+// the refresh interval, so large directory trees don't delay the registration. The first scan
+// runs when the discovery is created, the first registration already reports the files.
+type FileDiscovery struct {
+	options     FileDiscoveryOptions
+	mutex       sync.Mutex
+	files       []File
+	truncated   bool
+	lastRefresh time.Time
+	refreshing  bool
+}
+
+func NewFileDiscovery(options FileDiscoveryOptions) *FileDiscovery {
+	d := &FileDiscovery{options: options}
+	if len(options.Paths) > 0 {
+		d.refresh()
+	}
+	return d
+}
+
+// Files returns the last discovered file list and whether it was truncated to MaxEntries
+func (d *FileDiscovery) Files() ([]File, bool) {
+	if d == nil || len(d.options.Paths) == 0 {
+		return nil, false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.refreshing && time.Since(d.lastRefresh) >= d.options.RefreshInterval {
+		d.refreshing = true
+		go d.refresh()
+	}
+	return d.files, d.truncated
+}
+
+func (d *FileDiscovery) refresh() {
+	start := time.Now()
+	files, truncated := ListFiles(d.options)
+	log.Debugf("Listed %d log files in %v", len(files), time.Since(start))
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.files = files
+	d.truncated = truncated
+	d.lastRefresh = time.Now()
+	d.refreshing = false
+}
+
+// ListFiles walks the configured paths and returns the matching files and directories,
+// the second result is true if the list was cut at MaxEntries
+func ListFiles(options FileDiscoveryOptions) ([]File, bool) {
+	lister := &fileLister{options: options, list: []File{}, seen: make(map[string]bool)}
+	if options.FileDetails {
+		var err error
+		if lister.access, err = newFileAccessChecker(options.FileDetailsUser); err != nil {
+			log.Errorf("Can not check the readability of log files: %v", err)
+		}
+	}
+	for _, path := range options.Paths {
+		matches := []string{path}
+		if hasGlobMeta(path) {
+			var err error
+			if matches, err = filepath.Glob(path); err != nil {
+				log.Errorf("Invalid log file pattern %s: %v", path, err)
+				continue
+			}
+		}
+		for _, match := range matches {
+			if err := filepath.WalkDir(match, lister.walkFunc(match)); err != nil && err != errMaxEntries {
+				log.Errorf("Error listing files for %s: %v", match, err)
+			}
+			if lister.truncated {
+				log.Warnf("Log file list truncated to %d entries, adjust the list_log_files setting", options.MaxEntries)
+				return lister.list, true
+			}
+		}
+	}
+	return lister.list, false
+}
+
+type fileLister struct {
+	options   FileDiscoveryOptions
+	list      []File
+	seen      map[string]bool
+	truncated bool
+	access    *fileAccessChecker
+}
+
+func (l *fileLister) walkFunc(root string) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Errorf("Can not get file list for %s: %v", path, err)
+			// Make sure to return SkipDir here so the walk will continue!
+			return filepath.SkipDir
+		}
+		if path != root && matchesAnyPath(l.options.ExcludePatterns, path) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() && len(l.options.IncludePatterns) > 0 && !matchesAnyPath(l.options.IncludePatterns, path) {
+			return nil
+		}
+		if l.seen[path] {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		l.seen[path] = true
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if l.options.MaxEntries > 0 && len(l.list) >= l.options.MaxEntries {
+			l.truncated = true
+			return errMaxEntries
+		}
+		file := File{Path: path, ModTime: info.ModTime(), Size: info.Size(), IsDir: entry.IsDir()}
+		if l.options.FileDetails {
+			switch {
+			case entry.Type().IsRegular():
+				l.addDetails(&file, path, info)
+			case entry.Type()&fs.ModeSymlink != 0:
+				l.addLinkDetails(&file)
+			}
+		}
+		l.list = append(l.list, file)
+
+		if entry.IsDir() && l.options.MaxDepth > 0 && pathDepth(root, path) >= l.options.MaxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+}
+
+// target is the file which is actually read, it differs from file.Path for symlinks
+func (l *fileLister) addDetails(file *File, target string, info fs.FileInfo) {
+	if l.access != nil {
+		readable := l.access.readable(target, info)
+		file.Readable = &readable
+	}
+	file.Rotated = isRotatedFileName(file.Path)
+	file.Compressed = isCompressedFile(target)
+}
+
+// WalkDir doesn't follow links, but linked log files like Kubernetes' /var/log/containers/*.log
+// are read through the link. A dangling link can't be read at all.
+func (l *fileLister) addLinkDetails(file *File) {
+	target, err := filepath.EvalSymlinks(file.Path)
+	if err != nil {
+		if l.access != nil {
+			readable := false
+			file.Readable = &readable
+		}
+		return
+	}
+	info, err := os.Stat(target)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	l.addDetails(file, target, info)
+}
+
+// patterns without a path separator match the file name, the others the full path
+func matchesAnyPath(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		value := path
+		if !strings.ContainsAny(pattern, `/\`) {
+			value = filepath.Base(path)
+		}
+		if match, err := filepath.Match(pattern, value); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+func pathDepth(root string, path string) int {
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == "." {
+		return 0
+	}
+	return strings.Count(relative, string(filepath.Separator)) + 1
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
@@ -0,0 +1,191 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+func createFiles(t *testing.T, root string, paths ...string) {
+	for _, path := range paths {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("log"), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listedPaths(root string, files []File) []string {
+	result := []string{}
+	for _, file := range files {
+		relative, _ := filepath.Rel(root, file.Path)
+		result = append(result, filepath.ToSlash(relative))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestListFiles(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "syslog", "syslog.1", "app/app.log", "app/debug.txt", "app/archive/old.log",
+		"journal/system.journal", "svc/a/current", "svc/b/current")
+
+	cases := []struct {
+		name     string
+		options  FileDiscoveryOptions
+		expected []string
+	}{
+		{"everything", FileDiscoveryOptions{Paths: []string{root}},
+			[]string{".", "app", "app/app.log", "app/archive", "app/archive/old.log", "app/debug.txt",
+				"journal", "journal/system.journal", "svc", "svc/a", "svc/a/current", "svc/b", "svc/b/current",
+				"syslog", "syslog.1"}},
+		{"max depth", FileDiscoveryOptions{Paths: []string{root}, MaxDepth: 1},
+			[]string{".", "app", "journal", "svc", "syslog", "syslog.1"}},
+		{"include and exclude", FileDiscoveryOptions{Paths: []string{root},
+			IncludePatterns: []string{"*.log", "syslog*"}, ExcludePatterns: []string{"archive", "journal"}},
+			[]string{".", "app", "app/app.log", "svc", "svc/a", "svc/b", "syslog", "syslog.1"}},
+		{"glob", FileDiscoveryOptions{Paths: []string{filepath.Join(root, "svc", "*", "current"),
+			filepath.Join(root, "svc", "a")}},
+			[]string{"svc/a", "svc/a/current", "svc/b/current"}},
+	}
+	for _, c := range cases {
+		files, truncated := ListFiles(c.options)
+		if truncated {
+			t.Errorf("%s: list should not be truncated", c.name)
+		}
+		paths := listedPaths(root, files)
+		if len(paths) != len(c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, paths)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != c.expected[i] {
+				t.Errorf("%s: expected %v, got %v", c.name, c.expected, paths)
+				break
+			}
+		}
+	}
+}
+
+func TestListFilesTruncated(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "a.log", "b.log", "c.log", "d.log")
+
+	files, truncated := ListFiles(FileDiscoveryOptions{Paths: []string{root}, MaxEntries: 3})
+	if !truncated || len(files) != 3 {
+		t.Fatalf("expected 3 entries and truncated list, got %d entries, truncated %v", len(files), truncated)
+	}
+}
+
+func TestFileDiscoveryRefresh(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "a.log")
+	discovery := NewFileDiscovery(FileDiscoveryOptions{Paths: []string{root}, RefreshInterval: time.Hour})
+
+	// the first scan is done when the discovery is created
+	files, _ := discovery.Files()
+	if len(files) != 2 {
+		t.Fatalf("expected 2 entries, got %v", files)
+	}
+
+	// cached until the refresh interval has passed
+	createFiles(t, root, "b.log")
+	if files, _ = discovery.Files(); len(files) != 2 {
+		t.Fatalf("expected cached list with 2 entries, got %v", files)
+	}
+}
+
+func TestRotatedFileName(t *testing.T) {
+	cases := map[string]bool{
+		"/var/log/syslog":                false,
+		"/var/log/syslog.1":              true,
+		"/var/log/syslog.2.gz":           true,
+		"/var/log/messages-20240101":     true,
+		"/var/log/app.log.2024-01-01":    true,
+		"/var/log/app-2024-01-01.log.gz": true,
+		"/var/log/python3.log":           false,
+		"/var/log/worker.1.log":          false,
+	}
+	for path, expected := range cases {
+		if rotated := isRotatedFileName(path); rotated != expected {
+			t.Errorf("%s: expected rotated %v, got %v", path, expected, rotated)
+		}
+	}
+}
+
+func TestFileDetails(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "app.log", "app.log.1")
+	// compressed content without a telling file name
+	if err := os.WriteFile(filepath.Join(root, "archive"), []byte{0x1f, 0x8b, 0x08, 0x00}, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ListFiles(FileDiscoveryOptions{Paths: []string{root}, FileDetails: true})
+	details := make(map[string]File)
+	for _, file := range files {
+		details[filepath.Base(file.Path)] = file
+	}
+	if dir := details[filepath.Base(root)]; dir.Readable != nil {
+		t.Error("directories should not have file details")
+	}
+	if file := details["app.log"]; file.Readable == nil || !*file.Readable || file.Rotated || file.Compressed {
+		t.Errorf("unexpected details for app.log: %+v", file)
+	}
+	if file := details["app.log.1"]; !file.Rotated || file.Compressed {
+		t.Errorf("unexpected details for app.log.1: %+v", file)
+	}
+	if file := details["archive"]; file.Rotated || !file.Compressed {
+		t.Errorf("unexpected details for archive: %+v", file)
+	}
+
+	// linked log files are checked through their target, like Kubernetes' /var/log/containers/*.log
+	if runtime.GOOS != "windows" {
+		linkDir := t.TempDir()
+		os.Symlink(filepath.Join(root, "app.log.1"), filepath.Join(linkDir, "container.log.1"))
+		os.Symlink(filepath.Join(root, "archive"), filepath.Join(linkDir, "archive.log"))
+		os.Symlink(filepath.Join(root, "missing.log"), filepath.Join(linkDir, "dangling.log"))
+		files, _ := ListFiles(FileDiscoveryOptions{Paths: []string{linkDir}, FileDetails: true})
+		for _, file := range files {
+			details[filepath.Base(file.Path)] = file
+		}
+		if file := details["container.log.1"]; file.Readable == nil || !*file.Readable || !file.Rotated {
+			t.Errorf("unexpected details for linked log file: %+v", file)
+		}
+		if file := details["archive.log"]; !file.Compressed {
+			t.Errorf("unexpected details for linked archive: %+v", file)
+		}
+		if file := details["dangling.log"]; file.Readable == nil || *file.Readable {
+			t.Errorf("dangling link should not be readable: %+v", file)
+		}
+	}
+
+	// without file details nothing is checked
+	files, _ = ListFiles(FileDiscoveryOptions{Paths: []string{root}})
+	for _, file := range files {
+		if file.Readable != nil || file.Rotated || file.Compressed {
+			t.Errorf("unexpected details for %s: %+v", file.Path, file)
+		}
+	}
+}
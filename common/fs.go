@@ -16,8 +16,12 @@
 package common
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/Graylog2/collector-sidecar/logger"
 )
@@ -60,35 +64,43 @@ func CreatePathToFile(path string) error {
 	return nil
 }
 
-func ListFiles(paths []string) []File {
-	list := []File{}
+var (
+	validPathElement    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	reservedWindowsName = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9]|lpt[0-9])(\..*)?$`)
+)
 
-	filter := func(path string, file os.FileInfo, err error) error {
-		if err == nil {
-			list = append(list,
-				File{Path: path,
-					ModTime: file.ModTime(),
-					Size:    file.Size(),
-					IsDir:   file.IsDir()})
-			return nil
-		} else {
-			log.Errorf("Can not get file list for %s: %v", path, err)
-			// Make sure to return SkipDir here so the walk will
-			// continue!
-			return filepath.SkipDir
-		}
-	}
+const maxPathElementLength = 200
 
-	for _, path := range paths {
-		if !IsDir(path) {
-			continue
-		}
+// ValidatePathElement makes sure that an externally provided name can be used as a single
+// element of a file path. Only letters, digits, '_', '-' and '.' are allowed, the name must
+// not start with a dot or a hyphen and must not be a reserved Windows device name.
+func ValidatePathElement(elem string) error {
+	switch {
+	case elem == "":
+		return errors.New("name is empty")
+	case len(elem) > maxPathElementLength:
+		return fmt.Errorf("name is longer than %d characters", maxPathElementLength)
+	case !validPathElement.MatchString(elem):
+		return fmt.Errorf("name %q contains invalid characters", elem)
+	case reservedWindowsName.MatchString(elem):
+		return fmt.Errorf("name %q is a reserved device name", elem)
+	}
+	return nil
+}
 
-		err := filepath.Walk(path, filter)
-		if err != nil {
-			log.Errorf("Error listing files for %s: %v", path, err)
+// JoinPathInside joins validated path elements to baseDir and verifies that the result
+// doesn't leave baseDir.
+func JoinPathInside(baseDir string, elem ...string) (string, error) {
+	for _, e := range elem {
+		if err := ValidatePathElement(e); err != nil {
+			return "", err
 		}
 	}
-
-	return list
+	baseDir = filepath.Clean(baseDir)
+	path := filepath.Join(append([]string{baseDir}, elem...)...)
+	relativePath, err := filepath.Rel(baseDir, path)
+	if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+		return "", fmt.Errorf("path %q is outside of %s", path, baseDir)
+	}
+	return path, nil
 }
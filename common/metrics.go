@@ -0,0 +1,122 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package common
+
+import (
+	"path/filepath"
+)
+
+// Optional metric groups which can be enabled with `metric_groups`. The legacy metrics
+// cpu_idle, load_1 and disks_75 are always sent.
+const (
+	MetricGroupMemory      = "memory"
+	MetricGroupLoad        = "load"
+	MetricGroupFileSystems = "filesystems"
+	MetricGroupSystem      = "system"
+	MetricGroupNetwork     = "network"
+	MetricGroupDisks       = "disks"
+	MetricGroupCpu         = "cpu"
+)
+
+var MetricGroups = []string{MetricGroupMemory, MetricGroupLoad, MetricGroupFileSystems, MetricGroupSystem,
+	MetricGroupNetwork, MetricGroupDisks, MetricGroupCpu}
+
+const (
+	DiskUsageWarning  = "warning"
+	DiskUsageCritical = "critical"
+)
+
+type MemoryMetrics struct {
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+	SwapTotal   uint64  `json:"swap_total"`
+	SwapUsed    uint64  `json:"swap_used"`
+}
+
+type CpuMetrics struct {
+	Idle1m      float64   `json:"idle_1m"`
+	Idle5m      float64   `json:"idle_5m"`
+	CoresIdle1m []float64 `json:"cores_idle_1m,omitempty"`
+}
+
+type LoadMetrics struct {
+	Load1  float64 `json:"load_1"`
+	Load5  float64 `json:"load_5"`
+	Load15 float64 `json:"load_15"`
+}
+
+type FileSystemMetrics struct {
+	Path              string  `json:"path"`
+	Type              string  `json:"type,omitempty"`
+	Total             uint64  `json:"total"`
+	Used              uint64  `json:"used"`
+	UsedPercent       float64 `json:"used_percent"`
+	Inodes            uint64  `json:"inodes,omitempty"`
+	InodesUsedPercent float64 `json:"inodes_used_percent,omitempty"`
+}
+
+type SystemMetrics struct {
+	UptimeSeconds uint64 `json:"uptime_seconds"`
+	Processes     int    `json:"processes"`
+}
+
+type NetworkInterfaceMetrics struct {
+	Name      string `json:"name"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// DiskUsageMetrics is reported for filesystems above the warning threshold
+type DiskUsageMetrics struct {
+	Path        string  `json:"path"`
+	UsedPercent float64 `json:"used_percent"`
+	Level       string  `json:"level"`
+}
+
+// FileSystemFilter selects the filesystems which are reported. Mount points and filesystem types
+// are matched as wildcard patterns, an empty include list includes everything.
+type FileSystemFilter struct {
+	WindowsDriveRange  string
+	IncludeMountPoints []string
+	ExcludeMountPoints []string
+	IncludeFsTypes     []string
+	ExcludeFsTypes     []string
+}
+
+func (f *FileSystemFilter) Matches(mountPoint string, fsType string) bool {
+	if len(f.IncludeMountPoints) > 0 && !matchesAnyPattern(f.IncludeMountPoints, mountPoint) {
+		return false
+	}
+	if matchesAnyPattern(f.ExcludeMountPoints, mountPoint) {
+		return false
+	}
+	if len(f.IncludeFsTypes) > 0 && !matchesAnyPattern(f.IncludeFsTypes, fsType) {
+		return false
+	}
+	return !matchesAnyPattern(f.ExcludeFsTypes, fsType)
+}
+
+func matchesAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if match, err := filepath.Match(pattern, value); (err == nil && match) || pattern == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package common
+
+import (
+	"testing"
+)
+
+func TestFileSystemFilter(t *testing.T) {
+	filter := &FileSystemFilter{
+		IncludeMountPoints: []string{"/", "/var*", "/data/*"},
+		ExcludeMountPoints: []string{"/var/lib/docker*"},
+		ExcludeFsTypes:     []string{"tmpfs", "overlay"},
+	}
+
+	cases := []struct {
+		mountPoint string
+		fsType     string
+		matches    bool
+	}{
+		{"/", "ext4", true},
+		{"/var", "xfs", true},
+		{"/data/archive", "xfs", true},
+		{"/var/lib/docker", "ext4", false},
+		{"/home", "ext4", false},
+		{"/data/cache", "tmpfs", false},
+		{"/var/lib/docker/overlay2/1/merged", "overlay", false},
+	}
+	for _, c := range cases {
+		if result := filter.Matches(c.mountPoint, c.fsType); result != c.matches {
+			t.Errorf("%s (%s): expected %v, got %v", c.mountPoint, c.fsType, c.matches, result)
+		}
+	}
+
+	filter = &FileSystemFilter{IncludeFsTypes: []string{"ext*"}}
+	if !filter.Matches("/boot", "ext2") || filter.Matches("/boot/efi", "vfat") {
+		t.Error("filesystem type include list is not applied")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package common
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const procNetDev = "/proc/net/dev"
+
+// GetNetworkInterfaceMetrics returns the error and drop counters of all interfaces except loopback.
+// gosigar doesn't provide interface statistics, so they are read from /proc/net/dev.
+func GetNetworkInterfaceMetrics() []NetworkInterfaceMetrics {
+	file, err := os.Open(procNetDev)
+	if err != nil {
+		log.Debug("Failed to read network interface statistics")
+		return nil
+	}
+	defer file.Close()
+	return parseNetDev(file)
+}
+
+// parseNetDev reads the receive errs/drop and transmit errs/drop columns of /proc/net/dev:
+//
+//	Inter-|   Receive                                                |  Transmit
+//	 face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+//	  eth0: 1024    10      1    2    0    0     0          0         2048     20      3    4    0    0     0       0
+func parseNetDev(reader io.Reader) []NetworkInterfaceMetrics {
+	result := []NetworkInterfaceMetrics{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		nameAndValues := strings.SplitN(scanner.Text(), ":", 2)
+		if len(nameAndValues) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(nameAndValues[0])
+		fields := strings.Fields(nameAndValues[1])
+		if name == "lo" || len(fields) < 12 {
+			continue
+		}
+		counter := func(i int) uint64 {
+			value, _ := strconv.ParseUint(fields[i], 10, 64)
+			return value
+		}
+		result = append(result, NetworkInterfaceMetrics{
+			Name:      name,
+			RxErrors:  counter(2),
+			RxDropped: counter(3),
+			TxErrors:  counter(10),
+			TxDropped: counter(11),
+		})
+	}
+	return result
+}
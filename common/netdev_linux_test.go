@@ -0,0 +1,37 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNetDev(t *testing.T) {
+	netDev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 1024    10      0    0    0    0     0          0         1024     10      0    0    0    0     0       0
+  eth0: 2048    20      1    2    0    0     0          0         4096     40      3    4    0    0     0       0
+`
+	result := parseNetDev(strings.NewReader(netDev))
+	if len(result) != 1 {
+		t.Fatalf("expected one interface without loopback, got %v", result)
+	}
+	expected := NetworkInterfaceMetrics{Name: "eth0", RxErrors: 1, RxDropped: 2, TxErrors: 3, TxDropped: 4}
+	if result[0] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, result[0])
+	}
+}
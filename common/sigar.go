@@ -22,6 +22,7 @@ import (
 	"math"
 	"os"
 	"runtime"
+	"time"
 
 	sigar "github.com/elastic/gosigar"
 )
@@ -90,7 +91,12 @@ func (cpu *CPU) AddCpuPercentage(t2 *CpuTimes) {
 	cpu.LastCpuTimes = GetCpuPercentage(cpu.LastCpuTimes, t2)
 }
 
+// GetCpuIdle returns the idle percentage of the last minute if the background sampler is
+// running, otherwise since the previous call.
 func GetCpuIdle() float64 {
+	if idle, ok := cpuSampler.Idle(time.Minute); ok {
+		return idle
+	}
 	cpuStat, err := GetCpuTimes()
 	if err != nil {
 		return -1
@@ -100,32 +106,129 @@ func GetCpuIdle() float64 {
 	return cpu.LastCpuTimes.IdlePercent * 100
 }
 
-func GetFileSystemList75(windowsDriveRange string) []string {
+// GetFileSystemList returns the filesystems above the threshold as "<path> (<percent>)"
+func GetFileSystemList(filter *FileSystemFilter, threshold float64) []string {
 	result := []string{}
-	volumes := []sigar.FileSystem{}
+	for _, volume := range getVolumes(filter) {
+		dirName := volume.DirName
+		usage := sigar.FileSystemUsage{}
+		usage.Get(dirName)
+
+		if usage.UsePercent() >= threshold {
+			result = append(result, fmt.Sprintf("%s (%s)",
+				dirName,
+				sigar.FormatPercent(usage.UsePercent())))
+		}
+	}
+	return result
+}
+
+// GetDiskUsageMetrics returns the filesystems above the warning threshold. A critical
+// threshold of 0 disables the critical level.
+func GetDiskUsageMetrics(filter *FileSystemFilter, warning float64, critical float64) []DiskUsageMetrics {
+	result := []DiskUsageMetrics{}
+	for _, volume := range getVolumes(filter) {
+		usage := sigar.FileSystemUsage{}
+		if err := usage.Get(volume.DirName); err != nil || usage.Total == 0 {
+			continue
+		}
+		usedPercent := round(usage.UsePercent(), .5, 2)
+		if usedPercent < warning {
+			continue
+		}
+		level := DiskUsageWarning
+		if critical > 0 && usedPercent >= critical {
+			level = DiskUsageCritical
+		}
+		result = append(result, DiskUsageMetrics{Path: volume.DirName, UsedPercent: usedPercent, Level: level})
+	}
+	return result
+}
 
+func GetFileSystemMetrics(filter *FileSystemFilter) []FileSystemMetrics {
+	result := []FileSystemMetrics{}
+	for _, volume := range getVolumes(filter) {
+		usage := sigar.FileSystemUsage{}
+		if err := usage.Get(volume.DirName); err != nil || usage.Total == 0 {
+			continue
+		}
+		metrics := FileSystemMetrics{
+			Path:        volume.DirName,
+			Type:        volume.SysTypeName,
+			Total:       usage.Total,
+			Used:        usage.Used,
+			UsedPercent: round(usage.UsePercent(), .5, 2),
+		}
+		// not available on Windows
+		if usage.Files > 0 {
+			metrics.Inodes = usage.Files
+			metrics.InodesUsedPercent = percent(usage.Files-usage.FreeFiles, usage.Files)
+		}
+		result = append(result, metrics)
+	}
+	return result
+}
+
+func getVolumes(filter *FileSystemFilter) []sigar.FileSystem {
+	var volumes []sigar.FileSystem
 	if runtime.GOOS == "windows" {
-		volumes = getWindowsDrives(windowsDriveRange)
+		volumes = getWindowsDrives(filter.WindowsDriveRange)
 	} else {
 		fslist := sigar.FileSystemList{}
 		fslist.Get()
 		volumes = fslist.List
 	}
 
+	result := []sigar.FileSystem{}
 	for _, volume := range volumes {
-		dirName := volume.DirName
-		usage := sigar.FileSystemUsage{}
-		usage.Get(dirName)
-
-		if usage.UsePercent() >= 75 {
-			result = append(result, fmt.Sprintf("%s (%s)",
-				dirName,
-				sigar.FormatPercent(usage.UsePercent())))
+		if filter.Matches(volume.DirName, volume.SysTypeName) {
+			result = append(result, volume)
 		}
 	}
 	return result
 }
 
+func GetMemoryMetrics() *MemoryMetrics {
+	mem := sigar.Mem{}
+	if err := mem.Get(); err != nil {
+		log.Debug("Failed to get memory usage")
+		return nil
+	}
+	swap := sigar.Swap{}
+	if err := swap.Get(); err != nil {
+		log.Debug("Failed to get swap usage")
+	}
+	return &MemoryMetrics{
+		Total:       mem.Total,
+		Used:        mem.ActualUsed,
+		UsedPercent: percent(mem.ActualUsed, mem.Total),
+		SwapTotal:   swap.Total,
+		SwapUsed:    swap.Used,
+	}
+}
+
+func GetLoadMetrics() *LoadMetrics {
+	avg := sigar.LoadAverage{}
+	if err := avg.Get(); err != nil {
+		log.Debug("Failed to get load average")
+		return nil
+	}
+	return &LoadMetrics{Load1: avg.One, Load5: avg.Five, Load15: avg.Fifteen}
+}
+
+func GetSystemMetrics() *SystemMetrics {
+	uptime := sigar.Uptime{}
+	if err := uptime.Get(); err != nil {
+		log.Debug("Failed to get uptime")
+		return nil
+	}
+	processes := sigar.ProcList{}
+	if err := processes.Get(); err != nil {
+		log.Debug("Failed to get process list")
+	}
+	return &SystemMetrics{UptimeSeconds: uint64(uptime.Length), Processes: len(processes.List)}
+}
+
 func GetLoad1() float64 {
 	concreteSigar := sigar.ConcreteSigar{}
 
@@ -164,3 +267,10 @@ func round(val float64, roundOn float64, places int) (newVal float64) {
 	newVal = round / pow
 	return
 }
+
+func percent(part uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round(float64(part)/float64(total)*100, .5, 2)
+}
@@ -19,10 +19,37 @@ func GetCpuIdle() float64 {
 	return -1
 }
 
-func GetFileSystemList75(string) []string {
+func GetFileSystemList(*FileSystemFilter, float64) []string {
 	return []string{}
 }
 
+func GetDiskUsageMetrics(*FileSystemFilter, float64, float64) []DiskUsageMetrics {
+	return []DiskUsageMetrics{}
+}
+
 func GetLoad1() float64 {
 	return -1
 }
+
+func GetFileSystemMetrics(*FileSystemFilter) []FileSystemMetrics {
+	return []FileSystemMetrics{}
+}
+
+func GetMemoryMetrics() *MemoryMetrics {
+	return nil
+}
+
+func GetLoadMetrics() *LoadMetrics {
+	return nil
+}
+
+func GetSystemMetrics() *SystemMetrics {
+	return nil
+}
+
+func StartCpuSampler() {
+}
+
+func GetCpuMetrics() *CpuMetrics {
+	return nil
+}
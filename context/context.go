@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/Graylog2/collector-sidecar/common"
@@ -27,11 +28,18 @@ import (
 	"github.com/docker/go-units"
 
 	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/download"
 	"github.com/Graylog2/collector-sidecar/logger"
+	"github.com/Graylog2/collector-sidecar/policy"
+	"github.com/Graylog2/collector-sidecar/secrets"
 	"github.com/Graylog2/collector-sidecar/system"
+	"github.com/Graylog2/collector-sidecar/tags"
 )
 
-var log = logger.Log()
+var (
+	log           = logger.Log()
+	validLabelKey = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
 
 type Ctx struct {
 	ServerUrl  *url.URL
@@ -39,6 +47,18 @@ type Ctx struct {
 	NodeName   string
 	UserConfig *cfgfile.SidecarConfig
 	Inventory  *system.Inventory
+	// rules for the content of collector configurations, never nil after LoadConfig
+	ConfigurationPolicy *policy.Policy
+	// resolves ${secret:name} references when rendering collector configurations
+	Secrets *secrets.Resolver
+	// set if the API token is read from a file or command, see ServerApiToken()
+	apiToken *apiTokenSource
+	// a missing API token is not an error while the node is enrolled
+	Enrolling bool
+	// static and dynamic node tags, evaluated for every registration
+	Tags *tags.Collector
+	// cached list of the files in list_log_files
+	LogFiles *common.FileDiscovery
 }
 
 func NewContext() *Ctx {
@@ -55,18 +75,16 @@ func (ctx *Ctx) LoadConfig(path *string) error {
 	}
 
 	// Process top-level configuration
-	// server_url
-	ctx.ServerUrl, err = url.Parse(ctx.UserConfig.ServerUrl)
-	if err != nil || ctx.ServerUrl.Scheme == "" || ctx.ServerUrl.Host == "" {
-		log.Fatal("Server-url is not valid. Should be like http://127.0.0.1:9000/api/ ", err)
-	}
-	if ctx.UserConfig.ServerUrl == "" {
-		log.Fatalf("Server-url is empty.")
-	}
-
-	// api_token
-	if ctx.UserConfig.ServerApiToken == "" {
-		log.Fatal("No API token was configured.")
+	// server_url and api_token are not needed in standalone mode
+	if !ctx.UserConfig.Standalone {
+		// server_url
+		ctx.ServerUrl, err = url.Parse(ctx.UserConfig.ServerUrl)
+		if err != nil || ctx.ServerUrl.Scheme == "" || ctx.ServerUrl.Host == "" {
+			log.Fatal("Server-url is not valid. Should be like http://127.0.0.1:9000/api/ ", err)
+		}
+		if ctx.UserConfig.ServerUrl == "" {
+			log.Fatalf("Server-url is empty.")
+		}
 	}
 
 	// node_id
@@ -78,6 +96,11 @@ func (ctx *Ctx) LoadConfig(path *string) error {
 		log.Fatal("Empty node-id, exiting! Make sure a valid id is configured.")
 	}
 
+	// api_token, needs the node_id to verify enrolled node credentials
+	if !ctx.UserConfig.Standalone {
+		ctx.loadServerApiToken(*path)
+	}
+
 	// node_name
 	if ctx.UserConfig.NodeName == "" {
 		log.Info("No node name was configured, falling back to hostname")
@@ -111,6 +134,10 @@ func (ctx *Ctx) LoadConfig(path *string) error {
 	if err != nil {
 		log.Fatal("Cannot parse shutdown timeout duration: ", err)
 	}
+	ctx.UserConfig.CollectorActionTimeout, err = time.ParseDuration(ctx.UserConfig.CollectorActionTimeoutString)
+	if err != nil || ctx.UserConfig.CollectorActionTimeout <= 0 {
+		log.Fatal("Cannot parse collector action timeout duration: ", ctx.UserConfig.CollectorActionTimeoutString)
+	}
 
 	// collector_configuration_directory
 	if ctx.UserConfig.CollectorConfigurationDirectory == "" {
@@ -124,6 +151,18 @@ func (ctx *Ctx) LoadConfig(path *string) error {
 		log.Fatal("Failed to create collector configuration directory. ", err)
 	}
 
+	// collector_configuration_cleanup_grace_period
+	ctx.UserConfig.CollectorConfigurationCleanupGracePeriod, err = time.ParseDuration(ctx.UserConfig.CollectorConfigurationCleanupGracePeriodString)
+	if err != nil {
+		log.Fatal("Cannot parse configuration cleanup grace period: ", err)
+	}
+
+	// collector_diagnostics
+	ctx.UserConfig.CollectorDiagnostics.MaxSize, err = units.RAMInBytes(ctx.UserConfig.CollectorDiagnostics.MaxSizeString)
+	if err != nil || ctx.UserConfig.CollectorDiagnostics.MaxSize <= 0 {
+		log.Fatal("Cannot parse maximum size of collector diagnostics: ", ctx.UserConfig.CollectorDiagnostics.MaxSizeString)
+	}
+
 	// log_rotate_max_file_size
 	if ctx.UserConfig.LogRotateMaxFileSizeString == "" {
 		log.Fatal("Please set the maximum log rotation size.")
@@ -145,12 +184,62 @@ func (ctx *Ctx) LoadConfig(path *string) error {
 	// list log files
 	if len(ctx.UserConfig.ListLogFiles) > 0 {
 		for _, dir := range ctx.UserConfig.ListLogFiles {
-			if !common.IsDir(dir) {
-				log.Fatal("Please provide a list of directories for list_log_files.")
+			if strings.ContainsAny(dir, "*?[") {
+				if _, err := filepath.Match(dir, ""); err != nil {
+					log.Fatalf("Invalid pattern %q in list_log_files: %v", dir, err)
+				}
+			} else if !common.IsDir(dir) {
+				log.Fatal("Please provide a list of directories or patterns for list_log_files.")
 			}
 		}
 	}
 
+	// log_file_discovery
+	discovery := &ctx.UserConfig.LogFileDiscovery
+	if discovery.MaxDepth < 0 || discovery.MaxEntries < 0 {
+		log.Fatal("`log_file_discovery.max_depth` and `log_file_discovery.max_entries` must not be negative.")
+	}
+	discovery.RefreshInterval, err = time.ParseDuration(discovery.RefreshIntervalString)
+	if err != nil {
+		log.Fatal("Cannot parse log file discovery refresh interval: ", err)
+	}
+	discoveryOptions := common.FileDiscoveryOptions{
+		Paths:           ctx.UserConfig.ListLogFiles,
+		MaxDepth:        discovery.MaxDepth,
+		IncludePatterns: discovery.IncludePatterns,
+		ExcludePatterns: discovery.ExcludePatterns,
+		MaxEntries:      discovery.MaxEntries,
+		RefreshInterval: discovery.RefreshInterval,
+		FileDetails:     discovery.FileDetails,
+		FileDetailsUser: discovery.FileDetailsUser,
+	}
+	if err := discoveryOptions.Validate(); err != nil {
+		log.Fatal("Invalid `log_file_discovery` settings: ", err)
+	}
+	ctx.LogFiles = common.NewFileDiscovery(discoveryOptions)
+
+	// primary_ip
+	if err := helpers.ValidatePrimaryIpSelector(ctx.UserConfig.PrimaryIp); err != nil {
+		log.Fatal("Invalid `primary_ip`: ", err)
+	}
+
+	// metric_groups
+	for _, group := range ctx.UserConfig.MetricGroups {
+		if !helpers.IsInList(group, common.MetricGroups) {
+			log.Fatalf("Unknown metric group %q. Valid groups are: %v", group, common.MetricGroups)
+		}
+	}
+
+	// disk_usage
+	diskUsage := ctx.UserConfig.DiskUsage
+	if diskUsage.WarningThreshold <= 0 || diskUsage.WarningThreshold > 100 {
+		log.Fatal("`disk_usage.warning_threshold` must be a percentage between 0 and 100.")
+	}
+	if diskUsage.CriticalThreshold != 0 &&
+		(diskUsage.CriticalThreshold < diskUsage.WarningThreshold || diskUsage.CriticalThreshold > 100) {
+		log.Fatal("`disk_usage.critical_threshold` must be 0 or a percentage between the warning threshold and 100.")
+	}
+
 	// update_interval
 	if !(ctx.UserConfig.UpdateInterval > 0) {
 		log.Fatal("Please set update interval > 0 seconds.")
@@ -167,6 +256,63 @@ func (ctx *Ctx) LoadConfig(path *string) error {
 		ctx.UserConfig.CollectorBinariesAccesslist = ctx.UserConfig.CollectorBinariesWhitelist
 	}
 
+	// configuration_policy_file
+	ctx.ConfigurationPolicy, err = policy.Load(ctx.UserConfig.ConfigurationPolicyFile)
+	if err != nil {
+		log.Fatal("Cannot load configuration policy: ", err)
+	}
+
+	// labels
+	for key := range ctx.UserConfig.Labels {
+		if !validLabelKey.MatchString(key) {
+			log.Fatalf("Invalid label %q. Label keys may only contain letters, digits, '_' and '-'.", key)
+		}
+	}
+
+	// tags, tags_directory, tags_env_prefix, tags_commands
+	ctx.Tags = tags.NewCollector(ctx.UserConfig)
+	// inventory_tags
+	if ctx.UserConfig.InventoryTags {
+		ctx.Tags.AddStatic(ctx.Inventory.Tags()...)
+	}
+
+	// secret_providers
+	ctx.Secrets = newSecretResolver(ctx.UserConfig.SecretProviders)
+
+	// self_update
+	selfUpdate := &ctx.UserConfig.SelfUpdate
+	if selfUpdate.Enabled {
+		if _, err := download.ParsePublicKey(selfUpdate.PublicKey); err != nil {
+			log.Fatal("`self_update.public_key` is required to verify updates: ", err)
+		}
+		selfUpdate.CheckInterval, err = time.ParseDuration(selfUpdate.CheckIntervalString)
+		if err != nil || selfUpdate.CheckInterval <= 0 {
+			log.Fatal("Cannot parse self-update check interval: ", selfUpdate.CheckIntervalString)
+		}
+		selfUpdate.RollbackTimeout, err = time.ParseDuration(selfUpdate.RollbackTimeoutString)
+		if err != nil || selfUpdate.RollbackTimeout <= 0 {
+			log.Fatal("Cannot parse self-update rollback timeout: ", selfUpdate.RollbackTimeoutString)
+		}
+	}
+
+	// collector_install
+	collectorInstall := &ctx.UserConfig.CollectorInstall
+	if collectorInstall.Enabled {
+		if _, err := download.ParsePublicKey(collectorInstall.PublicKey); err != nil {
+			log.Fatal("`collector_install.public_key` is required to verify collector packages: ", err)
+		}
+		if len(ctx.UserConfig.CollectorBinariesAccesslist) == 0 {
+			log.Fatal("`collector_binaries_accesslist` is required to install collectors")
+		}
+		if collectorInstall.Directory == "" {
+			log.Fatal("`collector_install.directory` is required to install collectors")
+		}
+		collectorInstall.CheckInterval, err = time.ParseDuration(collectorInstall.CheckIntervalString)
+		if err != nil || collectorInstall.CheckInterval <= 0 {
+			log.Fatal("Cannot parse collector install check interval: ", collectorInstall.CheckIntervalString)
+		}
+	}
+
 	// windows_drive_range
 	driveRangeValid, _ := regexp.MatchString("^[A-Z]*$", ctx.UserConfig.WindowsDriveRange)
 	if !driveRangeValid {
@@ -175,3 +321,97 @@ func (ctx *Ctx) LoadConfig(path *string) error {
 
 	return nil
 }
+
+func newSecretResolver(config cfgfile.SecretProviders) *secrets.Resolver {
+	var providers []secrets.Provider
+	if config.Directory != "" {
+		if !filepath.IsAbs(config.Directory) {
+			log.Fatal("Secret provider directory must be an absolute path.")
+		}
+		providers = append(providers, &secrets.FileProvider{Directory: config.Directory})
+	}
+	if config.EnvPrefix != "" {
+		providers = append(providers, &secrets.EnvProvider{Prefix: config.EnvPrefix})
+	}
+	if config.Command != "" {
+		providers = append(providers, &secrets.CommandProvider{Command: config.Command})
+	}
+	if len(providers) > 0 {
+		log.AddHook(secrets.LogHook{})
+	}
+	return secrets.NewResolver(providers...)
+}
+
+// server_api_token, server_api_token_file, server_api_token_command
+func (ctx *Ctx) loadServerApiToken(configPath string) {
+	config := ctx.UserConfig
+	refreshInterval, err := time.ParseDuration(config.ServerApiTokenRefreshIntervalString)
+	if err != nil || refreshInterval <= 0 {
+		log.Fatal("Cannot parse API token refresh interval: ", config.ServerApiTokenRefreshIntervalString)
+	}
+	config.ServerApiTokenRefreshInterval = refreshInterval
+
+	sources := 0
+	for _, source := range []string{config.ServerApiToken, config.ServerApiTokenFile, config.ServerApiTokenCommand} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources == 0 {
+		// the enrollment creates the node credentials
+		if !ctx.Enrolling {
+			ctx.loadNodeCredentials()
+		}
+		return
+	}
+	if sources > 1 {
+		log.Fatal("Only one of `server_api_token`, `server_api_token_file` and `server_api_token_command` can be set.")
+	}
+
+	if config.ServerApiToken != "" {
+		checkCredentialFilePermissions(configPath, "Configuration file with `server_api_token`")
+		return
+	}
+
+	if config.ServerApiTokenFile != "" {
+		if !filepath.IsAbs(config.ServerApiTokenFile) {
+			log.Fatal("`server_api_token_file` must be an absolute path.")
+		}
+		checkCredentialFilePermissions(config.ServerApiTokenFile, "API token file")
+	}
+	ctx.apiToken = &apiTokenSource{
+		file:            config.ServerApiTokenFile,
+		command:         config.ServerApiTokenCommand,
+		refreshInterval: refreshInterval,
+	}
+	// a missing token is retried on every request, e.g. if the file is provisioned after startup
+	if ctx.apiToken.get() == "" {
+		log.Error("No API token available yet.")
+	}
+}
+
+// use the credentials stored by the enrollment if no token is configured
+func (ctx *Ctx) loadNodeCredentials() {
+	path := NodeCredentialsPath()
+	credentials, err := ReadNodeCredentials(path)
+	if os.IsNotExist(err) {
+		log.Fatal("No API token was configured. Set `server_api_token` or enroll this node with -enroll.")
+	}
+	if err != nil {
+		log.Fatalf("Failed to read node credentials %s: %v", path, err)
+	}
+	if credentials.NodeId != ctx.NodeId {
+		log.Fatalf("Node credentials %s were issued for node %s, not for %s. Enroll this node again.",
+			path, credentials.NodeId, ctx.NodeId)
+	}
+	checkCredentialFilePermissions(path, "Node credentials file")
+	log.Infof("Using node credentials from %s", path)
+
+	// the credentials are re-read like a token file, a new enrollment takes effect without a restart
+	ctx.apiToken = &apiTokenSource{
+		file:            path,
+		nodeId:          ctx.NodeId,
+		refreshInterval: ctx.UserConfig.ServerApiTokenRefreshInterval,
+	}
+	ctx.apiToken.get()
+}
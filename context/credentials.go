@@ -0,0 +1,82 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/common"
+)
+
+// NodeCredentials are obtained by enrolling the node with a one-time enrollment token
+type NodeCredentials struct {
+	NodeId     string    `json:"node_id"`
+	Token      string    `json:"token"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// NodeCredentialsPath is the location of the credentials stored by the enrollment
+func NodeCredentialsPath() string {
+	return common.ConfigBasePath("node-credentials.json")
+}
+
+func ReadNodeCredentials(path string) (*NodeCredentials, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseNodeCredentials(content)
+}
+
+func parseNodeCredentials(content []byte) (*NodeCredentials, error) {
+	credentials := &NodeCredentials{}
+	if err := json.Unmarshal(content, credentials); err != nil {
+		return nil, fmt.Errorf("invalid node credentials: %v", err)
+	}
+	if credentials.Token == "" {
+		return nil, fmt.Errorf("node credentials contain no token")
+	}
+	return credentials, nil
+}
+
+// WriteNodeCredentials replaces the credentials file atomically, it's only readable by the owner
+func WriteNodeCredentials(path string, credentials *NodeCredentials) error {
+	content, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	// temporary files are created with mode 0600
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".node-credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,36 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+//go:build !windows
+// +build !windows
+
+package context
+
+import (
+	"os"
+)
+
+// warn about files holding credentials which can be read by every user.
+// Windows permissions are ACL based and not checked.
+func checkCredentialFilePermissions(path string, description string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		log.Warnf("%s %s is world-readable (%s). Restrict its permissions, e.g. chmod o-rwx %s",
+			description, path, info.Mode().Perm(), path)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package context
+
+import (
+	"bytes"
+	gocontext "context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/helpers"
+)
+
+const tokenCommandTimeout = 30 * time.Second
+
+// apiTokenSource reads the server API token from `server_api_token_file` or
+// `server_api_token_command` and refreshes it to follow token rotation.
+type apiTokenSource struct {
+	mutex           sync.Mutex
+	file            string
+	command         string
+	nodeId          string // if set, file contains the node credentials of this node
+	refreshInterval time.Duration
+	token           string
+	lastRead        time.Time
+	fileModTime     time.Time
+	fileSize        int64
+}
+
+// get returns the cached token and re-reads it when the refresh interval elapsed
+// or the token file changed. On failure the previous token is kept.
+func (s *apiTokenSource) get() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.needsRefresh() {
+		token, err := s.read()
+		s.lastRead = time.Now()
+		if err != nil {
+			log.Errorf("Failed to read server API token, keeping the previous one: %v", err)
+		} else if token == "" {
+			log.Error("Server API token source returned an empty token, keeping the previous one")
+		} else {
+			if s.token != "" && token != s.token {
+				log.Info("Server API token changed, using the new token")
+			}
+			s.token = token
+		}
+	}
+	return s.token
+}
+
+func (s *apiTokenSource) needsRefresh() bool {
+	if s.lastRead.IsZero() || time.Since(s.lastRead) >= s.refreshInterval {
+		return true
+	}
+	if s.file != "" {
+		info, err := os.Stat(s.file)
+		return err == nil && (!info.ModTime().Equal(s.fileModTime) || info.Size() != s.fileSize)
+	}
+	return false
+}
+
+func (s *apiTokenSource) read() (string, error) {
+	if s.command != "" {
+		return runTokenCommand(s.command)
+	}
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(s.file)
+	if err != nil {
+		return "", err
+	}
+	s.fileModTime = info.ModTime()
+	s.fileSize = info.Size()
+	if s.nodeId != "" {
+		credentials, err := parseNodeCredentials(content)
+		if err != nil {
+			return "", err
+		}
+		if credentials.NodeId != s.nodeId {
+			return "", fmt.Errorf("node credentials were issued for node %s", credentials.NodeId)
+		}
+		return credentials.Token, nil
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func runTokenCommand(command string) (string, error) {
+	args, err := helpers.SplitCommandLine(command)
+	if err != nil || len(args) == 0 {
+		return "", fmt.Errorf("invalid command %q", command)
+	}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), tokenCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), gocontext.DeadlineExceeded) {
+			return "", fmt.Errorf("command timed out after %s", tokenCommandTimeout)
+		}
+		return "", fmt.Errorf("command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// ServerApiToken returns the token used to authenticate against the server
+func (ctx *Ctx) ServerApiToken() string {
+	if ctx.apiToken == nil {
+		return ctx.UserConfig.ServerApiToken
+	}
+	return ctx.apiToken.get()
+}
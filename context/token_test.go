@@ -0,0 +1,51 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApiTokenFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-token")
+	if err := os.WriteFile(path, []byte("first-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &Ctx{apiToken: &apiTokenSource{file: path, refreshInterval: time.Hour}}
+	if token := ctx.ServerApiToken(); token != "first-token" {
+		t.Fatalf("expected first-token, got %q", token)
+	}
+
+	// a changed file is picked up before the refresh interval elapsed
+	if err := os.WriteFile(path, []byte("second-token-rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token := ctx.ServerApiToken(); token != "second-token-rotated" {
+		t.Fatalf("expected second-token-rotated, got %q", token)
+	}
+
+	// the previous token is kept if the file can't be read
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	ctx.apiToken.lastRead = time.Time{}
+	if token := ctx.ServerApiToken(); token != "second-token-rotated" {
+		t.Fatalf("expected previous token to be kept, got %q", token)
+	}
+}
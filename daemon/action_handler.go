@@ -16,60 +16,131 @@
 package daemon
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/Graylog2/collector-sidecar/api/graylog"
 	"github.com/Graylog2/collector-sidecar/backends"
+	"github.com/Graylog2/collector-sidecar/context"
 	"github.com/Graylog2/collector-sidecar/helpers"
 )
 
-func HandleCollectorActions(actions []graylog.ResponseCollectorAction) {
+type actionFunc func(backend *backends.Backend, runner Runner) error
+
+// HandleCollectorActions runs the actions sent by the server. Actions with an ID are only run once,
+// their results are reported with the next registration, see Actions.PendingResults().
+func HandleCollectorActions(actions []graylog.ResponseCollectorAction, context *context.Ctx, upload DiagnosticsUploader) {
 	for _, action := range actions {
-		backends := backends.Store.GetBackendsForCollectorId(action.BackendId)
-		if backends == nil {
-			log.Errorf("Got action for non-existing collector: %s", action.BackendId)
+		if action.Id != "" && !Actions.markSeen(action.Id) {
+			log.Debugf("Skipping already received collector action %s", action.Id)
 			continue
 		}
-		for _, backend := range backends {
-			switch {
-			case action.Properties["start"] == true:
-				startAction(backend)
-			case action.Properties["restart"] == true:
-				restartAction(backend)
-			case action.Properties["stop"] == true:
-				stopAction(backend)
-			default:
-				log.Infof("Got unsupported collector command: %s", helpers.Inspect(action.Properties))
-			}
+		start := time.Now()
+		err := handleCollectorAction(action, context, upload)
+		if action.Id != "" {
+			Actions.addResult(action, err, time.Since(start))
 		}
 	}
 }
 
-func startAction(backend *backends.Backend) {
-	for id, runner := range Daemon.Runner {
-		if id == backend.Id {
-			if !runner.Running() {
-				log.Infof("[%s] Got remote start command", backend.Name)
-				runner.Restart()
-			} else {
-				log.Infof("Collector [%s] is already running, skipping start action.", backend.Name)
-			}
+func handleCollectorAction(action graylog.ResponseCollectorAction, context *context.Ctx, upload DiagnosticsUploader) error {
+	instances := backends.Store.GetBackendsForCollectorId(action.BackendId)
+	if instances == nil {
+		log.Errorf("Got action for non-existing collector: %s", action.BackendId)
+		return fmt.Errorf("collector %s is not assigned to this node", action.BackendId)
+	}
+
+	var run actionFunc
+	switch {
+	case action.Properties["start"] == true:
+		run = startAction
+	case action.Properties["restart"] == true:
+		run = restartAction
+	case action.Properties["stop"] == true:
+		run = stopAction
+	case action.Properties["diagnostics"] == true:
+		run = func(backend *backends.Backend, _ Runner) error {
+			return diagnosticsAction(backend, context, upload)
 		}
+	default:
+		log.Infof("Got unsupported collector command: %s", helpers.Inspect(action.Properties))
+		return errors.New("unsupported action")
 	}
-}
 
-func restartAction(backend *backends.Backend) {
-	for id, runner := range Daemon.Runner {
-		if id == backend.Id {
-			log.Infof("[%s] Got remote restart command", backend.Name)
-			runner.Restart()
+	var failures []string
+	for _, backend := range instances {
+		if backend.Local {
+			log.Warnf("[%s] Ignoring remote action for locally defined collector: %s",
+				backend.Name, helpers.Inspect(action.Properties))
+			failures = append(failures, fmt.Sprintf("[%s] locally defined collector", backend.Name))
+			continue
+		}
+		runner := Daemon.GetRunnerByBackendId(backend.Id)
+		if runner == nil {
+			failures = append(failures, fmt.Sprintf("[%s] no collector instance", backend.Name))
+			continue
+		}
+		if err := runWithTimeout(run, backend, runner, context.UserConfig.CollectorActionTimeout); err != nil {
+			log.Errorf("[%s] Collector action failed: %v", backend.Name, err)
+			failures = append(failures, fmt.Sprintf("[%s] %v", backend.Name, err))
 		}
 	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, ", "))
+	}
+	return nil
 }
 
-func stopAction(backend *backends.Backend) {
-	for id, runner := range Daemon.Runner {
-		if id == backend.Id {
-			log.Infof("[%s] Got remote stop command", backend.Name)
-			runner.Shutdown()
-		}
+// the action keeps running in the background after the timeout, its result is not reported anymore.
+// Further actions for the backend are rejected until it finished, they would act on the runner concurrently.
+func runWithTimeout(run actionFunc, backend *backends.Backend, runner Runner, timeout time.Duration) error {
+	if !Actions.startAction(backend.Id) {
+		return errors.New("previous action is still running")
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := run(backend, runner)
+		Actions.finishAction(backend.Id)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("action timed out after %v", timeout)
+	}
+}
+
+func startAction(backend *backends.Backend, runner Runner) error {
+	if runner.Running() {
+		log.Infof("Collector [%s] is already running, skipping start action.", backend.Name)
+		return nil
+	}
+	log.Infof("[%s] Got remote start command", backend.Name)
+	return runner.Restart()
+}
+
+func restartAction(backend *backends.Backend, runner Runner) error {
+	log.Infof("[%s] Got remote restart command", backend.Name)
+	return runner.Restart()
+}
+
+func stopAction(backend *backends.Backend, runner Runner) error {
+	log.Infof("[%s] Got remote stop command", backend.Name)
+	return runner.Shutdown()
+}
+
+func diagnosticsAction(backend *backends.Backend, context *context.Ctx, upload DiagnosticsUploader) error {
+	if !context.UserConfig.CollectorDiagnostics.Enabled {
+		log.Warnf("[%s] Ignoring remote diagnostics command, disabled by `collector_diagnostics.enabled`", backend.Name)
+		return errors.New("diagnostics are disabled on this node")
+	}
+	log.Infof("[%s] Got remote diagnostics command", backend.Name)
+	if err := upload(collectDiagnostics(backend, context)); err != nil {
+		log.Errorf("[%s] Failed to upload collector diagnostics: %v", backend.Name, err)
+		return fmt.Errorf("failed to upload diagnostics: %v", err)
 	}
+	return nil
 }
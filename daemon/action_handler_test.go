@@ -0,0 +1,105 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/backends"
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+func TestHandleCollectorActionsReportsResultsOnce(t *testing.T) {
+	Actions = newActionTracker()
+	ctx := &context.Ctx{UserConfig: &cfgfile.SidecarConfig{CollectorActionTimeout: time.Second}}
+	action := graylog.ResponseCollectorAction{
+		Id:         "action-1",
+		BackendId:  "unknown-collector",
+		Properties: map[string]interface{}{"restart": true},
+	}
+
+	// the same action is delivered twice, actions without an ID have no result
+	HandleCollectorActions([]graylog.ResponseCollectorAction{action, action}, ctx, nil)
+	HandleCollectorActions([]graylog.ResponseCollectorAction{{BackendId: "unknown-collector"}}, ctx, nil)
+
+	results := Actions.PendingResults()
+	if len(results) != 1 {
+		t.Fatalf("expected one result, got %v", results)
+	}
+	if results[0].ActionId != "action-1" || results[0].CollectorId != "unknown-collector" || results[0].Success {
+		t.Errorf("unexpected result %+v", results[0])
+	}
+	if len(Actions.PendingResults()) != 0 {
+		t.Error("results should only be returned once")
+	}
+
+	Actions.RequeueResults(results)
+	if len(Actions.PendingResults()) != 1 {
+		t.Error("requeued results should be returned again")
+	}
+}
+
+func TestPendingResultsAreLimited(t *testing.T) {
+	tracker := newActionTracker()
+	for i := 0; i < maxPendingResults+10; i++ {
+		tracker.addResult(graylog.ResponseCollectorAction{Id: fmt.Sprint(i)}, nil, 0)
+	}
+	results := tracker.PendingResults()
+	if len(results) != maxPendingResults || results[0].ActionId != "10" {
+		t.Fatalf("expected the newest %d results, got %d starting at %+v", maxPendingResults, len(results), results[0])
+	}
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	backend := &backends.Backend{Name: "test"}
+	failing := func(*backends.Backend, Runner) error { return errors.New("failed") }
+	if err := runWithTimeout(failing, backend, nil, time.Second); err == nil || err.Error() != "failed" {
+		t.Errorf("expected action error, got %v", err)
+	}
+
+	release := make(chan struct{})
+	blocking := func(*backends.Backend, Runner) error {
+		<-release
+		return nil
+	}
+	if err := runWithTimeout(blocking, backend, nil, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout, got %v", err)
+	}
+
+	// the timed out action still runs, a new action must not overlap with it
+	succeeding := func(*backends.Backend, Runner) error { return nil }
+	if err := runWithTimeout(succeeding, backend, nil, time.Second); err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Errorf("expected overlapping action to be rejected, got %v", err)
+	}
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := runWithTimeout(succeeding, backend, nil, time.Second)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("action still rejected after the previous one finished: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
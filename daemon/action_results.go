@@ -0,0 +1,125 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/assignments"
+)
+
+const (
+	// received action IDs are remembered this long to ignore re-delivered actions
+	actionIdRetention = time.Hour
+	// results are only reported to servers supporting them, older results are dropped meanwhile
+	maxPendingResults = 100
+)
+
+// Actions keeps the IDs of received collector actions and the results which still have to be reported
+var Actions = newActionTracker()
+
+type actionTracker struct {
+	mutex   sync.Mutex
+	seen    map[string]time.Time
+	results []graylog.ActionResultRequest
+	// backends with an action still running, e.g. after its timeout
+	inFlight map[assignments.BackendKey]bool
+}
+
+func newActionTracker() *actionTracker {
+	return &actionTracker{
+		seen:     make(map[string]time.Time),
+		inFlight: make(map[assignments.BackendKey]bool),
+	}
+}
+
+// startAction returns false if the previous action of the backend is still running
+func (t *actionTracker) startAction(id assignments.BackendKey) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.inFlight[id] {
+		return false
+	}
+	t.inFlight[id] = true
+	return true
+}
+
+func (t *actionTracker) finishAction(id assignments.BackendKey) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.inFlight, id)
+}
+
+// markSeen returns false if the action was received before
+func (t *actionTracker) markSeen(id string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	for seenId, received := range t.seen {
+		if now.Sub(received) > actionIdRetention {
+			delete(t.seen, seenId)
+		}
+	}
+	if _, ok := t.seen[id]; ok {
+		return false
+	}
+	t.seen[id] = now
+	return true
+}
+
+func (t *actionTracker) addResult(action graylog.ResponseCollectorAction, err error, duration time.Duration) {
+	result := graylog.ActionResultRequest{
+		ActionId:    action.Id,
+		CollectorId: action.BackendId,
+		Success:     err == nil,
+		DurationMs:  duration.Milliseconds(),
+	}
+	if err != nil {
+		result.Message = err.Error()
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.results = limitResults(append(t.results, result))
+}
+
+// PendingResults returns and removes the results which have not been reported yet
+func (t *actionTracker) PendingResults() []graylog.ActionResultRequest {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	results := t.results
+	t.results = nil
+	return results
+}
+
+// RequeueResults keeps results for the next registration if they could not be delivered
+func (t *actionTracker) RequeueResults(results []graylog.ActionResultRequest) {
+	if len(results) == 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.results = limitResults(append(results, t.results...))
+}
+
+// limitResults keeps the newest maxPendingResults results
+func limitResults(results []graylog.ActionResultRequest) []graylog.ActionResultRequest {
+	if len(results) > maxPendingResults {
+		return results[len(results)-maxPendingResults:]
+	}
+	return results
+}
@@ -40,7 +40,7 @@ type DaemonConfig struct {
 	Dir string
 	Env []string
 
-	Runner map[string]Runner
+	Runner map[assignments.BackendKey]Runner
 }
 
 func init() {
@@ -59,7 +59,7 @@ func NewConfig() *DaemonConfig {
 		Description: fmt.Sprintf("Wrapper service for %s controlled collector", common.VendorName),
 		Dir:         rootDir,
 		Env:         []string{},
-		Runner:      map[string]Runner{},
+		Runner:      map[assignments.BackendKey]Runner{},
 	}
 
 	return dc
@@ -92,7 +92,7 @@ func (dc *DaemonConfig) AddRunner(backend backends.Backend, context *context.Ctx
 	dc.Runner[backend.Id] = runner
 }
 
-func (dc *DaemonConfig) DeleteRunner(backendId string) {
+func (dc *DaemonConfig) DeleteRunner(backendId assignments.BackendKey) {
 	if dc.Runner[backendId] == nil {
 		return
 	}
@@ -105,7 +105,7 @@ func (dc *DaemonConfig) DeleteRunner(backendId string) {
 	delete(dc.Runner, backendId)
 }
 
-func (dc *DaemonConfig) GetRunnerByBackendId(id string) Runner {
+func (dc *DaemonConfig) GetRunnerByBackendId(id assignments.BackendKey) Runner {
 	for _, runner := range dc.Runner {
 		if runner.GetBackend().Id == id {
 			return runner
@@ -146,7 +146,7 @@ func (dc *DaemonConfig) SyncWithAssignments(context *context.Ctx) {
 
 		// cleanup backends that should not run anymore
 		if backend == nil || assignments.Store.GetAssignment(backend.Id) == "" {
-			log.Info("Removing process runner: " + id)
+			log.Info("Removing process runner: " + id.String())
 			dc.DeleteRunner(id)
 		}
 	}
@@ -162,6 +162,10 @@ func (dc *DaemonConfig) SyncWithAssignments(context *context.Ctx) {
 	// add new backends to registry
 	for _, backend := range assignedBackends {
 		if dc.Runner[backend.Id] == nil {
+			// refused backends still get a runner to report their status, but it will never start
+			if err := backend.CheckAssignmentPolicy(context); err != nil {
+				backend.SetStatusLogErrorf("%s", err)
+			}
 			log.Info("Adding process runner for: " + backend.Name)
 			dc.AddRunner(*backend, context)
 		}
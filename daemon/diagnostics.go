@@ -0,0 +1,98 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package daemon
+
+import (
+	"os"
+	"strings"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/backends"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/secrets"
+)
+
+// DiagnosticsUploader sends the result of the "diagnostics" action to the server
+type DiagnosticsUploader func(diagnostics *graylog.CollectorDiagnosticsRequest) error
+
+// collectDiagnostics gathers the collector logs, the configuration template and the output of the
+// validation command. The configuration is taken from the template with all ${secret:...} references
+// replaced, the rendered file is never uploaded. All resolved secrets are redacted before every part
+// is limited to `collector_diagnostics.max_size`, a cut can't leave a partial secret behind.
+func collectDiagnostics(backend *backends.Backend, context *context.Ctx) *graylog.CollectorDiagnosticsRequest {
+	maxSize := context.UserConfig.CollectorDiagnostics.MaxSize
+	diagnostics := &graylog.CollectorDiagnosticsRequest{
+		CollectorId:     backend.CollectorId,
+		ConfigurationId: backend.ConfigId,
+	}
+	var truncated bool
+
+	if path, err := backends.BuildLogPath(context, backend.Name, "stdout"); err == nil {
+		diagnostics.Stdout, truncated = tailFile(path, maxSize)
+		diagnostics.Truncated = diagnostics.Truncated || truncated
+	}
+	if path, err := backends.BuildLogPath(context, backend.Name, "stderr"); err == nil {
+		diagnostics.Stderr, truncated = tailFile(path, maxSize)
+		diagnostics.Truncated = diagnostics.Truncated || truncated
+	}
+	if backend.Template != "" {
+		diagnostics.Configuration, truncated = head(backends.RedactSecretVariables(backend.Template), maxSize)
+		diagnostics.Truncated = diagnostics.Truncated || truncated
+	}
+
+	err, output := backend.ValidateConfigurationFile(context)
+	if err != nil {
+		diagnostics.ValidationError = secrets.Redact(err.Error())
+	}
+	output = secrets.Redact(output)
+	if int64(len(output)) > maxSize {
+		output = output[len(output)-int(maxSize):]
+		diagnostics.Truncated = true
+	}
+	diagnostics.ValidationOutput = output
+	return diagnostics
+}
+
+// readRedacted reads a whole file, collector logs are limited by the log rotation
+func readRedacted(path string) (string, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return secrets.Redact(string(content)), true
+}
+
+// tailFile returns the last maxSize bytes of a redacted file, starting at a complete line if it was cut
+func tailFile(path string, maxSize int64) (string, bool) {
+	content, ok := readRedacted(path)
+	if !ok || int64(len(content)) <= maxSize {
+		return content, false
+	}
+	content = content[int64(len(content))-maxSize:]
+	if i := strings.IndexByte(content, '\n'); i >= 0 && i < len(content)-1 {
+		content = content[i+1:]
+	}
+	return content, true
+}
+
+// head returns the first maxSize bytes of the redacted content
+func head(content string, maxSize int64) (string, bool) {
+	content = secrets.Redact(content)
+	if int64(len(content)) <= maxSize {
+		return content, false
+	}
+	return content[:maxSize], true
+}
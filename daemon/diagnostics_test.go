@@ -0,0 +1,102 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/backends"
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/secrets"
+)
+
+func TestCollectDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &context.Ctx{UserConfig: &cfgfile.SidecarConfig{
+		LogPath:              dir,
+		CollectorDiagnostics: cfgfile.Diagnostics{Enabled: true, MaxSize: 32},
+	}}
+	backend := &backends.Backend{
+		Name:        "filebeat-1234",
+		CollectorId: "filebeat",
+		ConfigId:    "1234",
+		Template:    "pw: ${secret:pw}\nkey: s3cr3t-diagnostics\n",
+	}
+	secrets.AddRedaction("s3cr3t-diagnostics")
+	files := map[string]string{
+		"filebeat-1234_stdout.log": "started\n",
+		"filebeat-1234_stderr.log": "first line is dropped\nerror: connection refused\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diagnostics := collectDiagnostics(backend, ctx)
+	if diagnostics.CollectorId != "filebeat" || diagnostics.ConfigurationId != "1234" {
+		t.Errorf("unexpected IDs: %+v", diagnostics)
+	}
+	if diagnostics.Stdout != "started\n" {
+		t.Errorf("unexpected stdout %q", diagnostics.Stdout)
+	}
+	// the tail starts at a complete line
+	if diagnostics.Stderr != "error: connection refused\n" || !diagnostics.Truncated {
+		t.Errorf("unexpected stderr %q, truncated %v", diagnostics.Stderr, diagnostics.Truncated)
+	}
+	// the secret reference is replaced and resolved values in the template are redacted as well
+	if diagnostics.Configuration != "pw: [REDACTED]\nkey: [REDACTED]\n" {
+		t.Errorf("configuration not redacted: %q", diagnostics.Configuration)
+	}
+}
+
+func TestHead(t *testing.T) {
+	if content, truncated := head("0123456789", 4); content != "0123" || !truncated {
+		t.Errorf("expected truncated head, got %q, %v", content, truncated)
+	}
+	if content, truncated := head("0123456789", 10); content != "0123456789" || truncated {
+		t.Errorf("expected complete content, got %q, %v", content, truncated)
+	}
+}
+
+func TestDiagnosticsRedactBeforeTruncating(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	secrets.AddRedaction("cut-through-secret")
+	// the cap ends inside the secret for the head and starts inside it for the tail
+	if err := os.WriteFile(path, []byte("key: cut-through-secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	headFile := func(path string, maxSize int64) (string, bool) {
+		content, _ := os.ReadFile(path)
+		return head(string(content), maxSize)
+	}
+	for name, read := range map[string]func(string, int64) (string, bool){"head": headFile, "tail": tailFile} {
+		content, truncated := read(path, 12)
+		if !truncated {
+			t.Errorf("%s: expected truncated content", name)
+		}
+		for _, part := range []string{"cut-thr", "secret", "through"} {
+			if strings.Contains(content, part) {
+				t.Errorf("%s: partial secret %q in %q", name, part, content)
+			}
+		}
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"runtime"
 	"sync/atomic"
 	"time"
@@ -65,10 +64,9 @@ func NewExecRunner(backend backends.Backend, context *context.Ctx) Runner {
 		args:         backend.ExecuteParameters,
 		restartCount: 1,
 		signals:      make(chan string),
-		stderr:       filepath.Join(context.UserConfig.LogPath, backend.Name+"_stderr.log"),
-		stdout:       filepath.Join(context.UserConfig.LogPath, backend.Name+"_stdout.log"),
 		terminate:    make(chan error),
 	}
+	r.setLogPaths(backend.Name)
 
 	// set default state
 	r.setRunning(false)
@@ -111,21 +109,39 @@ func (r *ExecRunner) GetBackend() *backends.Backend {
 func (r *ExecRunner) SetBackend(b backends.Backend) {
 	r.backend = b
 	r.name = b.Name
-	r.stderr = filepath.Join(r.context.UserConfig.LogPath, b.Name+"_stderr.log")
-	r.stdout = filepath.Join(r.context.UserConfig.LogPath, b.Name+"_stdout.log")
+	r.setLogPaths(b.Name)
 	r.exec = b.ExecutablePath
 	r.args = b.ExecuteParameters
 	r.restartCount = 1
 }
 
+// collector output is only redirected to files if the name is safe to be used in a path
+func (r *ExecRunner) setLogPaths(name string) {
+	var err error
+	r.stderr, err = backends.BuildLogPath(r.context, name, "stderr")
+	if err != nil {
+		log.Errorf("[%s] Not writing collector stderr log: %s", name, err)
+	}
+	r.stdout, err = backends.BuildLogPath(r.context, name, "stdout")
+	if err != nil {
+		log.Errorf("[%s] Not writing collector stdout log: %s", name, err)
+	}
+}
+
 func (r *ExecRunner) ResetRestartCounter() {
 	r.restartCount = 1
 }
 
 func (r *ExecRunner) ValidateBeforeStart() error {
+	if err := r.backend.CheckIdentifiers(); err != nil {
+		return r.backend.SetStatusLogErrorf("Refusing to start collector: %s", err)
+	}
+	if err := r.backend.CheckAssignmentPolicy(r.context); err != nil {
+		return r.backend.SetStatusLogErrorf("%s", err)
+	}
 	err := r.backend.CheckExecutableAgainstAccesslist(r.context)
 	if err != nil {
-		r.backend.SetStatusLogErrorf(err.Error())
+		r.backend.SetStatusLogErrorf("%s", err)
 		return err
 	}
 
@@ -195,6 +211,7 @@ func (r *ExecRunner) start() error {
 	if err := r.ValidateBeforeStart(); err != nil {
 		return err
 	}
+	r.backend.DetectVersion(r.context)
 
 	// setup process environment
 	var err error
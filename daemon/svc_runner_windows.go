@@ -124,9 +124,15 @@ func (r *SvcRunner) SetBackend(b backends.Backend) {
 }
 
 func (r *SvcRunner) ValidateBeforeStart() error {
+	if err := r.backend.CheckIdentifiers(); err != nil {
+		return r.backend.SetStatusLogErrorf("Refusing to install collector service: %s", err)
+	}
+	if err := r.backend.CheckAssignmentPolicy(r.context); err != nil {
+		return r.backend.SetStatusLogErrorf("%s", err)
+	}
 	err := r.backend.CheckExecutableAgainstAccesslist(r.context)
 	if err != nil {
-		r.backend.SetStatusLogErrorf(err.Error())
+		r.backend.SetStatusLogErrorf("%s", err)
 		return err
 	}
 
@@ -216,6 +222,7 @@ func (r *SvcRunner) start() error {
 		log.Errorf("[%s] %s", r.Name(), err)
 		return err
 	}
+	r.backend.DetectVersion(r.context)
 
 	r.startTime = time.Now()
 	log.Infof("[%s] Starting (%s driver)", r.name, r.backend.ServiceType)
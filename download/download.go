@@ -0,0 +1,140 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package download
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifests are small, artifacts are limited by the caller
+const maxManifestSize = 1 << 20
+
+// File downloads url to path. The file is written to a temporary file next to path first and only
+// renamed to path if its size is within maxSize and its SHA-256 checksum matches.
+func File(client *http.Client, url string, path string, sha256Hex string, maxSize int64) error {
+	expected, err := hex.DecodeString(strings.TrimSpace(sha256Hex))
+	if err != nil || len(expected) != sha256.Size {
+		return fmt.Errorf("invalid sha256 checksum %q", sha256Hex)
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download of %s failed: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	digest := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, digest), io.LimitReader(resp.Body, maxSize+1))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written > maxSize {
+		return fmt.Errorf("download of %s exceeds the maximum size of %d bytes", url, maxSize)
+	}
+	if err := verifyDigest(digest, expected); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// JSON fetches url and decodes the JSON response into v
+func JSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(v)
+}
+
+// FileChecksum returns the hex encoded SHA-256 checksum of a file
+func FileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// ParsePublicKey decodes a base64 encoded Ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return key, nil
+}
+
+// VerifySignature checks a base64 encoded Ed25519 signature of message
+func VerifySignature(key ed25519.PublicKey, message []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	if !ed25519.Verify(key, message, sig) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+func verifyDigest(digest hash.Hash, expected []byte) error {
+	if actual := digest.Sum(nil); !bytes.Equal(actual, expected) {
+		return fmt.Errorf("checksum mismatch: expected %x, got %x", expected, actual)
+	}
+	return nil
+}
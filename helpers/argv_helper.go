@@ -21,5 +21,4 @@ package helpers
 // Dummy function. Only used on Windows
 func CommandLineToArgv(cmd string) []string {
 	panic("not implemented on this platform")
-	return []string{}
 }
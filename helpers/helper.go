@@ -22,6 +22,7 @@ import (
 	"github.com/Graylog2/collector-sidecar/cfgfile"
 	"github.com/Graylog2/collector-sidecar/common"
 	"github.com/Graylog2/collector-sidecar/logger"
+	"github.com/flynn-archive/go-shlex"
 	"github.com/pborman/uuid"
 	"io/ioutil"
 	"net"
@@ -80,11 +81,20 @@ func GetHostIP() string {
 	return defaultIp
 }
 
+// GetCollectorId resolves the configured node ID. Supported forms are a literal ID, `file:<path>`,
+// `machine-id:[path]`, `hostname:` and `command:<command line>`.
 func GetCollectorId(collectorId string) string {
 	id := collectorId
-	if strings.HasPrefix(collectorId, "file:") {
+	switch {
+	case strings.HasPrefix(collectorId, "file:"):
 		filePath := strings.SplitAfterN(collectorId, ":", 2)[1]
 		id = idFromFile(filePath)
+	case strings.HasPrefix(collectorId, "machine-id:"):
+		id = idFromMachineId(strings.SplitAfterN(collectorId, ":", 2)[1])
+	case strings.HasPrefix(collectorId, "hostname:"):
+		id = idFromHostname()
+	case strings.HasPrefix(collectorId, "command:"):
+		id = idFromCommand(strings.SplitAfterN(collectorId, ":", 2)[1])
 	}
 
 	if id != "" && !cfgfile.ValidateConfig() {
@@ -97,12 +107,13 @@ func idFromFile(filePath string) string {
 	err := common.FileExists(filePath)
 	if err != nil {
 		log.Info("node-id file doesn't exist, generating a new one")
-		err = common.CreatePathToFile(filePath)
-		if err == nil {
-			err = ioutil.WriteFile(filePath, []byte(RandomUuid()), 0644)
-			if err != nil {
-				log.Error("Can not write node-id file: ", err)
-			}
+		if !writeIdFile(filePath) {
+			return ""
+		}
+	} else if !machineBindingMatches(filePath) {
+		log.Warn("node-id file was created on another machine, e.g. by cloning a VM image. Generating a new node-id.")
+		if !writeIdFile(filePath) {
+			return ""
 		}
 	}
 
@@ -114,6 +125,19 @@ func idFromFile(filePath string) string {
 	return strings.Trim(string(file), " \n")
 }
 
+func writeIdFile(filePath string) bool {
+	err := common.CreatePathToFile(filePath)
+	if err == nil {
+		err = ioutil.WriteFile(filePath, []byte(RandomUuid()), 0644)
+	}
+	if err != nil {
+		log.Error("Can not write node-id file: ", err)
+		return false
+	}
+	writeMachineBinding(filePath)
+	return true
+}
+
 func RandomUuid() string {
 	return uuid.NewRandom().String()
 }
@@ -232,3 +256,11 @@ func PathMatch(path string, patternList []string) (PathMatchResult, error) {
 	result.Match = false
 	return result, nil
 }
+
+// SplitCommandLine splits a command line into arguments using the quoting rules of the platform
+func SplitCommandLine(cmdline string) ([]string, error) {
+	if runtime.GOOS == "windows" {
+		return CommandLineToArgv(cmdline), nil
+	}
+	return shlex.Split(cmdline)
+}
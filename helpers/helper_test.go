@@ -210,3 +210,112 @@ func TestPathMatchSymlink(t *testing.T) {
 		t.Fatalf("result.Path did not contain resolved symlink")
 	}
 }
+
+func TestGetCollectorIdFromMachineId(t *testing.T) {
+	dir := t.TempDir()
+	machineIdFile := filepath.Join(dir, "machine-id")
+	if err := ioutil.WriteFile(machineIdFile, []byte("b08dfa6083e7567a1921a715000001fb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := GetCollectorId("machine-id:" + machineIdFile)
+	if result != GetCollectorId("machine-id:"+machineIdFile) {
+		t.Fatal("machine-id based node-id is not stable")
+	}
+	if strings.Contains(result, "b08dfa6083e7567a") {
+		t.Fatal("node-id must not expose the machine-id")
+	}
+	if match, _ := regexp.MatchString("^[0-9a-f]{8}-", result); !match {
+		t.Fatalf("expected UUID, got %q", result)
+	}
+
+	if GetCollectorId("machine-id:"+filepath.Join(dir, "missing")) != "" {
+		t.Fatal("missing machine-id should result in empty node-id")
+	}
+}
+
+func TestGetCollectorIdFromHostname(t *testing.T) {
+	result := GetCollectorId("hostname:")
+	if result == "" || result != GetCollectorId("hostname:") {
+		t.Fatalf("hostname based node-id is not stable: %q", result)
+	}
+}
+
+func TestGetCollectorIdFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses echo")
+	}
+	if result := GetCollectorId("command:echo node-1234"); result != "node-1234" {
+		t.Fatalf("expected node-1234, got %q", result)
+	}
+	if result := GetCollectorId("command:echo invalid id"); result != "" {
+		t.Fatalf("invalid command output should result in empty node-id, got %q", result)
+	}
+	if result := GetCollectorId("command:false"); result != "" {
+		t.Fatalf("failing command should result in empty node-id, got %q", result)
+	}
+}
+
+func TestGetCollectorIdFromCopiedFile(t *testing.T) {
+	if machineFingerprint() == "" {
+		t.Skip("no machine-id available")
+	}
+	tmpfile := filepath.Join(t.TempDir(), "node-id")
+	first := GetCollectorId("file:" + tmpfile)
+	if first == "" || GetCollectorId("file:"+tmpfile) != first {
+		t.Fatal("node-id from file is not stable")
+	}
+
+	// simulate a node-id file copied from another machine
+	if err := ioutil.WriteFile(machineBindingPath(tmpfile), []byte("other-machine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := GetCollectorId("file:" + tmpfile)
+	if second == "" || second == first {
+		t.Fatalf("copied node-id file should be regenerated, got %q", second)
+	}
+	if GetCollectorId("file:"+tmpfile) != second {
+		t.Fatal("regenerated node-id is not stable")
+	}
+}
+
+func TestSelectPrimaryIP(t *testing.T) {
+	interfaces := []NetworkInterface{
+		{Name: "lo", Loopback: true, Addresses: []string{"127.0.0.1/8", "::1/128"}},
+		{Name: "docker0", Addresses: []string{"172.17.0.1/16"}},
+		{Name: "eth0", Addresses: []string{"fe80::1/64", "2001:db8::10/64", "10.0.1.10/24"}},
+		{Name: "eth1", Addresses: []string{"fe80::2/64", "2001:db8:1::20/64"}},
+		{Name: "eth2", Addresses: []string{"fe80::3/64"}},
+		{Name: "ens0", Addresses: []string{"fe80::4/64", "169.254.10.1/16"}},
+		{Name: "ens1", Addresses: []string{"fe80::5/64", "192.0.2.5/24"}},
+	}
+	cases := map[string]string{
+		"interface:eth0":      "10.0.1.10",
+		"interface:eth*":      "10.0.1.10",
+		"interface:eth1":      "2001:db8:1::20",
+		"interface:eth2":      "",
+		"interface:wlan*":     "",
+		"interface:ens*":      "192.0.2.5",
+		"cidr:10.0.0.0/8":     "10.0.1.10",
+		"cidr:2001:db8::/32":  "2001:db8::10",
+		"cidr:192.168.0.0/16": "",
+	}
+	for selector, expected := range cases {
+		if ip := selectPrimaryIP(selector, interfaces); ip != expected {
+			t.Errorf("%s: expected %q, got %q", selector, expected, ip)
+		}
+	}
+}
+
+func TestValidatePrimaryIpSelector(t *testing.T) {
+	for _, selector := range []string{"", "route", "interface:eth*", "cidr:10.0.0.0/8"} {
+		if err := ValidatePrimaryIpSelector(selector); err != nil {
+			t.Errorf("%q should be valid: %v", selector, err)
+		}
+	}
+	for _, selector := range []string{"eth0", "interface:", "interface:[", "cidr:10.0.0.0", "gateway"} {
+		if err := ValidatePrimaryIpSelector(selector); err == nil {
+			t.Errorf("%q should be invalid", selector)
+		}
+	}
+}
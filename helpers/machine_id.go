@@ -0,0 +1,37 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+//go:build !windows
+// +build !windows
+
+package helpers
+
+import (
+	"io/ioutil"
+)
+
+var machineIdPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+func platformMachineId() (string, error) {
+	var err error
+	for _, path := range machineIdPaths {
+		var content []byte
+		content, err = ioutil.ReadFile(path)
+		if err == nil {
+			return validMachineId(string(content))
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package helpers
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const routeLookupTimeout = 5 * time.Second
+
+type NetworkInterface struct {
+	Name            string   `json:"name"`
+	HardwareAddress string   `json:"hardware_address,omitempty"`
+	Up              bool     `json:"up"`
+	Loopback        bool     `json:"loopback,omitempty"`
+	Addresses       []string `json:"addresses"` // IPv4 and IPv6 addresses in CIDR notation
+}
+
+// GetNetworkInterfaces returns all network interfaces with their addresses
+func GetNetworkInterfaces() []NetworkInterface {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		log.Errorf("Failed to list network interfaces: %v", err)
+		return nil
+	}
+	result := []NetworkInterface{}
+	for _, iface := range interfaces {
+		networkInterface := NetworkInterface{
+			Name:            iface.Name,
+			HardwareAddress: iface.HardwareAddr.String(),
+			Up:              iface.Flags&net.FlagUp != 0,
+			Loopback:        iface.Flags&net.FlagLoopback != 0,
+			Addresses:       []string{},
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Debugf("Failed to get addresses of network interface %s: %v", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				networkInterface.Addresses = append(networkInterface.Addresses, ipnet.String())
+			}
+		}
+		result = append(result, networkInterface)
+	}
+	return result
+}
+
+// ValidatePrimaryIpSelector checks the `primary_ip` setting, see GetPrimaryIP
+func ValidatePrimaryIpSelector(selector string) error {
+	kind, value, _ := strings.Cut(selector, ":")
+	switch {
+	case selector == "" || selector == "route":
+		return nil
+	case kind == "interface":
+		if _, err := filepath.Match(value, ""); err != nil || value == "" {
+			return fmt.Errorf("invalid interface pattern %q", value)
+		}
+		return nil
+	case kind == "cidr":
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown primary IP selector %q, use interface:<pattern>, cidr:<network> or route", selector)
+}
+
+// GetPrimaryIP returns the IP address reported to the server. The selector picks the address:
+//
+//	interface:<pattern>  first address of the first interface matching the wildcard pattern
+//	cidr:<network>       first address within the network
+//	route                local address used to reach the server
+//
+// IPv4 addresses are preferred. If nothing matches, or no selector is given, GetHostIP is used.
+func GetPrimaryIP(selector string, serverUrl *url.URL) string {
+	if selector == "" {
+		return GetHostIP()
+	}
+	var ip string
+	if selector == "route" {
+		ip = routeIP(serverUrl)
+	} else {
+		ip = selectPrimaryIP(selector, GetNetworkInterfaces())
+	}
+	if ip == "" {
+		log.Debugf("No IP address found for primary_ip %q, falling back to the first address", selector)
+		return GetHostIP()
+	}
+	return ip
+}
+
+func selectPrimaryIP(selector string, interfaces []NetworkInterface) string {
+	kind, value, _ := strings.Cut(selector, ":")
+	var network *net.IPNet
+	if kind == "cidr" {
+		var err error
+		if _, network, err = net.ParseCIDR(value); err != nil {
+			return ""
+		}
+	}
+
+	var candidates []net.IP
+	for _, iface := range interfaces {
+		if kind == "interface" {
+			if match, _ := filepath.Match(value, iface.Name); !match {
+				continue
+			}
+		}
+		for _, address := range iface.Addresses {
+			ip, _, err := net.ParseCIDR(address)
+			if err != nil || (network != nil && !network.Contains(ip)) {
+				continue
+			}
+			candidates = append(candidates, ip)
+		}
+		// the first matching interface with a usable address wins, e.g. not one with only link-local addresses
+		if kind == "interface" {
+			if ip := preferredIP(candidates); ip != "" {
+				return ip
+			}
+			candidates = nil
+		}
+	}
+	return preferredIP(candidates)
+}
+
+// IPv4 addresses are preferred, link-local addresses are never used
+func preferredIP(candidates []net.IP) string {
+	for _, ip := range candidates {
+		if ip.To4() != nil && !ip.IsLinkLocalUnicast() {
+			return ip.String()
+		}
+	}
+	for _, ip := range candidates {
+		if !ip.IsLinkLocalUnicast() {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// the local address of a UDP socket "connected" to the server, no packets are sent
+func routeIP(serverUrl *url.URL) string {
+	if serverUrl == nil || serverUrl.Hostname() == "" {
+		return ""
+	}
+	port := serverUrl.Port()
+	if port == "" {
+		port = "80"
+		if serverUrl.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(serverUrl.Hostname(), port), routeLookupTimeout)
+	if err != nil {
+		log.Debugf("Failed to find the route to the server: %v", err)
+		return ""
+	}
+	defer conn.Close()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
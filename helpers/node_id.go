@@ -0,0 +1,145 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+const nodeIdCommandTimeout = 10 * time.Second
+
+var (
+	// namespace of the name based UUIDs derived from machine IDs and host names
+	nodeIdNamespace = uuid.Parse("88aee159-e955-44f6-92d7-c42c4b029c29")
+	validCommandId  = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+)
+
+// the machine ID is hashed, it should not be exposed to the network
+func idFromMachineId(path string) string {
+	machineId, err := readMachineId(path)
+	if err != nil {
+		log.Error("Can not read machine-id: ", err)
+		return ""
+	}
+	return uuid.NewSHA1(nodeIdNamespace, []byte("machine-id:"+machineId)).String()
+}
+
+func idFromHostname() string {
+	hostname, err := GetHostname()
+	if err != nil || hostname == "" {
+		log.Error("Can not determine hostname: ", err)
+		return ""
+	}
+	return uuid.NewSHA1(nodeIdNamespace, []byte("hostname:"+strings.ToLower(hostname))).String()
+}
+
+func idFromCommand(cmdline string) string {
+	args, err := SplitCommandLine(cmdline)
+	if err != nil || len(args) == 0 {
+		log.Errorf("Invalid node-id command %q", cmdline)
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), nodeIdCommandTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		log.Errorf("node-id command failed: %v", err)
+		return ""
+	}
+	id := strings.TrimSpace(stdout.String())
+	if !validCommandId.MatchString(id) {
+		log.Errorf("node-id command returned an invalid ID %q", id)
+		return ""
+	}
+	return id
+}
+
+// readMachineId reads the machine ID from path or from the platform default location
+func readMachineId(path string) (string, error) {
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return validMachineId(string(content))
+	}
+	return platformMachineId()
+}
+
+func validMachineId(machineId string) (string, error) {
+	machineId = strings.TrimSpace(machineId)
+	if machineId == "" {
+		return "", errors.New("machine-id is empty")
+	}
+	return machineId, nil
+}
+
+// The machine a node-id file was created on is stored as hash next to it. A mismatch means
+// the file was copied to another machine. Without a machine ID the binding is not checked.
+func machineBindingPath(idFilePath string) string {
+	return idFilePath + ".machine"
+}
+
+func machineFingerprint() string {
+	machineId, err := platformMachineId()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte("node-id-binding:" + machineId))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeMachineBinding(idFilePath string) {
+	fingerprint := machineFingerprint()
+	if fingerprint == "" {
+		return
+	}
+	if err := ioutil.WriteFile(machineBindingPath(idFilePath), []byte(fingerprint+"\n"), 0644); err != nil {
+		log.Warn("Can not write node-id machine binding: ", err)
+	}
+}
+
+func machineBindingMatches(idFilePath string) bool {
+	fingerprint := machineFingerprint()
+	if fingerprint == "" {
+		return true
+	}
+	content, err := ioutil.ReadFile(machineBindingPath(idFilePath))
+	if os.IsNotExist(err) {
+		// node-id files of older versions are bound to the current machine
+		writeMachineBinding(idFilePath)
+		return true
+	} else if err != nil {
+		log.Warn("Can not read node-id machine binding: ", err)
+		return true
+	}
+	return strings.TrimSpace(string(content)) == fingerprint
+}
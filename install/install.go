@@ -0,0 +1,220 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package install
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/common"
+	"github.com/Graylog2/collector-sidecar/download"
+	"github.com/Graylog2/collector-sidecar/helpers"
+	"github.com/Graylog2/collector-sidecar/logger"
+)
+
+const maxPackageSize = 1 << 30
+
+var log = logger.Log()
+
+// Installer downloads collector binaries to <directory>/<name>/<version>/ and points the
+// package's install path to them with a symlink. Switching the link is atomic, a collector
+// never sees a partially written binary. Packages must be signed with the configured key.
+type Installer struct {
+	mutex      sync.Mutex
+	directory  string
+	accesslist []string
+	publicKey  ed25519.PublicKey
+}
+
+func NewInstaller(directory string, accesslist []string, publicKey ed25519.PublicKey) *Installer {
+	return &Installer{
+		directory:  directory,
+		accesslist: accesslist,
+		publicKey:  publicKey,
+	}
+}
+
+// Apply installs all packages which are not installed in the requested version yet. The install paths
+// of changed packages are returned, collectors running these binaries need a restart.
+func (i *Installer) Apply(httpClient *http.Client, packages []graylog.ResponseCollectorPackage) ([]string, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	s, err := readState(i.directory)
+	if err != nil {
+		return nil, fmt.Errorf("can't read installed collectors: %v", err)
+	}
+	var changed []string
+	var errs []error
+	for _, p := range packages {
+		// a manifest may list the packages of all platforms
+		if p.Os != "" && p.Arch != "" && (p.Os != runtime.GOOS || p.Arch != runtime.GOARCH) {
+			continue
+		}
+		if current, ok := s[p.Name]; ok && current.Version == p.Version && current.InstallPath == p.InstallPath {
+			continue
+		}
+		target, err := i.install(httpClient, p, s[p.Name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %v", p.Name, p.Version, err))
+			continue
+		}
+		log.Infof("[CollectorInstall] Installed %s %s to %s", p.Name, p.Version, p.InstallPath)
+		if previous := s[p.Name].InstallPath; previous != "" && previous != p.InstallPath {
+			os.Remove(previous)
+		}
+		s[p.Name] = installedCollector{
+			Version:         p.Version,
+			InstallPath:     p.InstallPath,
+			Target:          target,
+			PreviousVersion: s[p.Name].Version,
+		}
+		i.cleanup(p.Name, s[p.Name])
+		changed = append(changed, p.InstallPath)
+		if err := writeState(i.directory, s); err != nil {
+			errs = append(errs, fmt.Errorf("can't write installed collectors: %v", err))
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+func (i *Installer) install(httpClient *http.Client, p graylog.ResponseCollectorPackage, current installedCollector) (string, error) {
+	if p.Url == "" || p.Sha256 == "" || p.Signature == "" || p.InstallPath == "" {
+		return "", errors.New("package needs url, sha256, signature and install_path")
+	}
+	if p.Os != runtime.GOOS || p.Arch != runtime.GOARCH {
+		return "", fmt.Errorf("package is built for %s/%s", p.Os, p.Arch)
+	}
+	if err := download.VerifySignature(i.publicKey, signedMessage(p), p.Signature); err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(p.InstallPath) {
+		return "", fmt.Errorf("install path %s is not absolute", p.InstallPath)
+	}
+	target, err := common.JoinPathInside(i.directory, p.Name, p.Version, filepath.Base(p.InstallPath))
+	if err != nil {
+		return "", err
+	}
+	// the collector is started through the link, both paths have to pass the accesslist
+	for _, path := range []string{p.InstallPath, target} {
+		if err := i.checkAccesslist(path); err != nil {
+			return "", err
+		}
+	}
+	if err := checkLinkPath(p.InstallPath, current); err != nil {
+		return "", err
+	}
+
+	if checksum, err := download.FileChecksum(target); err != nil || checksum != strings.ToLower(strings.TrimSpace(p.Sha256)) {
+		if err := download.File(httpClient, p.Url, target, p.Sha256, maxPackageSize); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Chmod(target, 0755); err != nil {
+		return "", err
+	}
+	if err := switchLink(target, p.InstallPath); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// signedMessage binds the signature to the package name, version and platform, a signed binary
+// can't be advertised as another collector or version
+func signedMessage(p graylog.ResponseCollectorPackage) []byte {
+	return []byte(strings.Join([]string{
+		p.Name,
+		p.Version,
+		p.Os,
+		p.Arch,
+		strings.ToLower(strings.TrimSpace(p.Sha256)),
+	}, "|"))
+}
+
+// an empty accesslist would allow installing binaries to any path
+func (i *Installer) checkAccesslist(path string) error {
+	if len(i.accesslist) == 0 {
+		return errors.New("`collector_binaries_accesslist' must be configured to install collectors")
+	}
+	isListed, err := helpers.PathMatch(path, i.accesslist)
+	if err != nil {
+		return fmt.Errorf("can not validate binary path: %s", err)
+	}
+	if !isListed.Match {
+		return fmt.Errorf("%s is not included in `collector_binaries_accesslist' config option", isListed.Path)
+	}
+	return nil
+}
+
+// checkLinkPath refuses to replace files which were not installed by the sidecar, e.g. by a system package
+func checkLinkPath(installPath string, current installedCollector) error {
+	info, err := os.Lstat(installPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s already exists and is not managed by the sidecar", installPath)
+	}
+	if current.Target == "" {
+		return fmt.Errorf("%s is a link which is not managed by the sidecar", installPath)
+	}
+	return nil
+}
+
+// switchLink atomically points link to target by renaming a new link over the old one
+func switchLink(target string, link string) error {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+	tmp := link + ".new"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// cleanup removes all versions of a collector except the installed and the previous one
+func (i *Installer) cleanup(name string, installed installedCollector) {
+	versionsDir := filepath.Join(i.directory, name)
+	entries, err := os.ReadDir(versionsDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() == installed.Version || entry.Name() == installed.PreviousVersion {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(versionsDir, entry.Name())); err != nil {
+			log.Warnf("[CollectorInstall] Failed to remove old version %s of %s: %v", entry.Name(), name, err)
+		}
+	}
+}
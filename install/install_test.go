@@ -0,0 +1,227 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package install
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+)
+
+var testPublicKey, testPrivateKey, _ = ed25519.GenerateKey(rand.Reader)
+
+func checksum(content string) string {
+	digest := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(digest[:])
+}
+
+func setupInstaller(t *testing.T, accesslist func(dir string) []string) (*Installer, string, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path[1:]))
+	}))
+	t.Cleanup(server.Close)
+	dir := t.TempDir()
+	list := []string{filepath.Join(dir, "bin", "*"), filepath.Join(dir, "collectors", "*", "*", "*")}
+	if accesslist != nil {
+		list = accesslist(dir)
+	}
+	return NewInstaller(filepath.Join(dir, "collectors"), list, testPublicKey), dir, server
+}
+
+func sign(p *graylog.ResponseCollectorPackage) {
+	p.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(testPrivateKey, signedMessage(*p)))
+}
+
+func collectorPackage(server *httptest.Server, dir string, version string) graylog.ResponseCollectorPackage {
+	p := graylog.ResponseCollectorPackage{
+		Name:        "filebeat",
+		Version:     version,
+		Os:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		Url:         server.URL + "/" + version,
+		Sha256:      checksum(version),
+		InstallPath: filepath.Join(dir, "bin", "filebeat"),
+	}
+	sign(&p)
+	return p
+}
+
+func assertLink(t *testing.T, link string, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected {
+		t.Fatalf("expected %s to resolve to %q, got %q", link, expected, content)
+	}
+}
+
+func TestInstallAndUpgrade(t *testing.T) {
+	installer, dir, server := setupInstaller(t, nil)
+
+	p := collectorPackage(server, dir, "8.1.0")
+	changed, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 || changed[0] != p.InstallPath {
+		t.Fatalf("unexpected changed paths %v", changed)
+	}
+	assertLink(t, p.InstallPath, "8.1.0")
+
+	// nothing to do for the installed version
+	changed, err = installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p})
+	if err != nil || len(changed) != 0 {
+		t.Fatalf("expected no changes, got %v %v", changed, err)
+	}
+
+	for _, version := range []string{"8.2.0", "8.3.0"} {
+		if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{collectorPackage(server, dir, version)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertLink(t, p.InstallPath, "8.3.0")
+
+	// only the installed and the previous version are kept
+	entries, _ := os.ReadDir(filepath.Join(dir, "collectors", "filebeat"))
+	if len(entries) != 2 || entries[0].Name() != "8.2.0" || entries[1].Name() != "8.3.0" {
+		t.Fatalf("unexpected versions %v", entries)
+	}
+
+	installed := Installed(filepath.Join(dir, "collectors"))
+	if len(installed) != 1 || installed[0].Name != "filebeat" || installed[0].Version != "8.3.0" {
+		t.Fatalf("unexpected installed collectors %+v", installed)
+	}
+}
+
+func TestInstallRejectsChecksumMismatch(t *testing.T) {
+	installer, dir, server := setupInstaller(t, nil)
+	p := collectorPackage(server, dir, "8.1.0")
+	p.Sha256 = checksum("something else")
+	sign(&p)
+
+	changed, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p})
+	if err == nil || len(changed) != 0 {
+		t.Fatalf("expected checksum error, got %v %v", changed, err)
+	}
+	if _, err := os.Lstat(p.InstallPath); !os.IsNotExist(err) {
+		t.Fatal("install path was created")
+	}
+}
+
+func TestInstallRefusesUnmanagedFile(t *testing.T) {
+	installer, dir, server := setupInstaller(t, nil)
+	p := collectorPackage(server, dir, "8.1.0")
+	os.MkdirAll(filepath.Dir(p.InstallPath), 0755)
+	os.WriteFile(p.InstallPath, []byte("from a system package"), 0755)
+
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err == nil {
+		t.Fatal("expected error for unmanaged file")
+	}
+	assertLink(t, p.InstallPath, "from a system package")
+}
+
+func TestInstallChecksAccesslist(t *testing.T) {
+	installer, dir, server := setupInstaller(t, func(dir string) []string {
+		return []string{filepath.Join(dir, "bin", "filebeat")}
+	})
+	p := collectorPackage(server, dir, "8.1.0")
+
+	// the versioned binary is not covered by the accesslist
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err == nil {
+		t.Fatal("expected accesslist error")
+	}
+
+	installer.accesslist = append(installer.accesslist, filepath.Join(dir, "collectors", "*", "*", "*"))
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, p.InstallPath, "8.1.0")
+}
+
+func TestInstallRejectsInvalidNames(t *testing.T) {
+	installer, dir, server := setupInstaller(t, nil)
+	p := collectorPackage(server, dir, "8.1.0")
+	p.Version = "../../escape"
+	sign(&p)
+
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err == nil {
+		t.Fatal("expected error for invalid version")
+	}
+}
+
+func TestInstallVerifiesSignature(t *testing.T) {
+	installer, dir, server := setupInstaller(t, nil)
+
+	// the signature of one version can't be reused for another one
+	p := collectorPackage(server, dir, "8.1.0")
+	p.Version = "8.2.0"
+	p.Url = server.URL + "/8.2.0"
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err == nil {
+		t.Fatal("expected signature error")
+	}
+	p.Signature = ""
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err == nil {
+		t.Fatal("expected error for unsigned package")
+	}
+	if _, err := os.Lstat(p.InstallPath); !os.IsNotExist(err) {
+		t.Fatal("install path was created")
+	}
+
+	// the checksum is compared case-insensitively
+	p = collectorPackage(server, dir, "8.1.0")
+	p.Sha256 = strings.ToUpper(p.Sha256)
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, p.InstallPath, "8.1.0")
+}
+
+func TestInstallSkipsOtherPlatforms(t *testing.T) {
+	installer, dir, server := setupInstaller(t, nil)
+	p := collectorPackage(server, dir, "8.1.0")
+	p.Os = "plan9"
+	sign(&p)
+
+	changed, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p})
+	if err != nil || len(changed) != 0 {
+		t.Fatalf("expected package to be skipped, got %v %v", changed, err)
+	}
+}
+
+func TestInstallRequiresAccesslist(t *testing.T) {
+	installer, dir, server := setupInstaller(t, func(dir string) []string { return nil })
+	p := collectorPackage(server, dir, "8.1.0")
+
+	if _, err := installer.Apply(http.DefaultClient, []graylog.ResponseCollectorPackage{p}); err == nil {
+		t.Fatal("expected error without accesslist")
+	}
+	if _, err := os.Lstat(p.InstallPath); !os.IsNotExist(err) {
+		t.Fatal("install path was created")
+	}
+}
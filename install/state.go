@@ -0,0 +1,85 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package install
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+)
+
+const stateFile = "installed.json"
+
+// installed collector binaries by name, stored in the install directory
+type state map[string]installedCollector
+
+type installedCollector struct {
+	Version     string `json:"version"`
+	InstallPath string `json:"install_path"`
+	Target      string `json:"target"`
+	// kept until the next upgrade, so a broken version can be reverted manually
+	PreviousVersion string `json:"previous_version,omitempty"`
+}
+
+func readState(directory string) (state, error) {
+	s := state{}
+	content, err := os.ReadFile(filepath.Join(directory, stateFile))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(content, &s)
+}
+
+func writeState(directory string, s state) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(directory, stateFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Installed lists the collector binaries the sidecar installed into directory
+func Installed(directory string) []graylog.InstalledCollectorRequest {
+	s, err := readState(directory)
+	if err != nil {
+		log.Errorf("[CollectorInstall] Can't read installed collectors: %v", err)
+		return nil
+	}
+	installed := make([]graylog.InstalledCollectorRequest, 0, len(s))
+	for name, collector := range s {
+		installed = append(installed, graylog.InstalledCollectorRequest{
+			Name:        name,
+			Version:     collector.Version,
+			InstallPath: collector.InstallPath,
+		})
+	}
+	sort.Slice(installed, func(i, j int) bool { return installed[i].Name < installed[j].Name })
+	return installed
+}
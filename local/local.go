@@ -0,0 +1,160 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package local
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/assignments"
+	"github.com/Graylog2/collector-sidecar/backends"
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/logger"
+)
+
+var log = logger.Log()
+
+// Definitions holds the collectors, configurations and assignments defined in the
+// sidecar configuration file and in the local definitions drop-in directory.
+type Definitions struct {
+	collectors     map[string]cfgfile.LocalCollector
+	configurations map[string]cfgfile.LocalConfiguration
+	assignments    []assignments.ConfigurationAssignment
+}
+
+// NewDefinitions returns an empty set of local definitions
+func NewDefinitions() *Definitions {
+	return &Definitions{
+		collectors:     make(map[string]cfgfile.LocalCollector),
+		configurations: make(map[string]cfgfile.LocalConfiguration),
+	}
+}
+
+// Load merges the local definitions of the sidecar configuration with the ones found in
+// `local_definitions_directory`. Invalid entries are logged and skipped.
+func Load(ctx *context.Ctx) (*Definitions, error) {
+	dropIns, err := cfgfile.ReadLocalDefinitions(ctx.UserConfig.LocalDefinitionsDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := NewDefinitions()
+	var localAssignments []cfgfile.LocalAssignment
+	for _, d := range append([]cfgfile.LocalDefinitions{ctx.UserConfig.LocalDefinitions}, dropIns...) {
+		for _, collector := range d.Collectors {
+			if err := validateCollector(collector); err != nil {
+				log.Errorf("[LocalDefinitions] Skipping collector %q: %s", collector.Id, err)
+				continue
+			}
+			if _, ok := definitions.collectors[collector.Id]; ok {
+				log.Errorf("[LocalDefinitions] Skipping duplicate collector %q", collector.Id)
+				continue
+			}
+			definitions.collectors[collector.Id] = collector
+		}
+		for _, configuration := range d.Configurations {
+			if configuration.Id == "" || !filepath.IsAbs(configuration.TemplateFile) {
+				log.Errorf("[LocalDefinitions] Skipping configuration %q: id and an absolute template_file are required",
+					configuration.Id)
+				continue
+			}
+			if _, ok := definitions.configurations[configuration.Id]; ok {
+				log.Errorf("[LocalDefinitions] Skipping duplicate configuration %q", configuration.Id)
+				continue
+			}
+			definitions.configurations[configuration.Id] = configuration
+		}
+		localAssignments = append(localAssignments, d.Assignments...)
+	}
+
+	for _, assignment := range localAssignments {
+		if _, ok := definitions.collectors[assignment.CollectorId]; !ok {
+			log.Errorf("[LocalDefinitions] Skipping assignment of configuration %q, unknown collector %q",
+				assignment.ConfigurationId, assignment.CollectorId)
+			continue
+		}
+		if _, ok := definitions.configurations[assignment.ConfigurationId]; !ok {
+			log.Errorf("[LocalDefinitions] Skipping assignment to collector %q, unknown configuration %q",
+				assignment.CollectorId, assignment.ConfigurationId)
+			continue
+		}
+		definitions.assignments = append(definitions.assignments, assignments.ConfigurationAssignment{
+			BackendId:       assignment.CollectorId,
+			ConfigurationId: assignment.ConfigurationId,
+		})
+	}
+
+	return definitions, nil
+}
+
+func validateCollector(collector cfgfile.LocalCollector) error {
+	switch {
+	case collector.Id == "":
+		return fmt.Errorf("id is required")
+	case collector.Name == "":
+		return fmt.Errorf("name is required")
+	case collector.ExecutablePath == "":
+		return fmt.Errorf("executable_path is required")
+	}
+	return nil
+}
+
+// Assignments returns the locally defined configuration assignments
+func (d *Definitions) Assignments() []assignments.ConfigurationAssignment {
+	return d.assignments
+}
+
+// Backends returns one backend per local assignment, built the same way as for
+// collectors reported by the server.
+func (d *Definitions) Backends(ctx *context.Ctx) []backends.Backend {
+	backendList := []backends.Backend{}
+	for _, assignment := range d.assignments {
+		collector := d.collectors[assignment.BackendId]
+		serviceType := collector.ServiceType
+		if serviceType == "" {
+			serviceType = "exec"
+		}
+		response := graylog.ResponseCollectorBackend{
+			Id:                   collector.Id,
+			Name:                 collector.Name,
+			ServiceType:          serviceType,
+			ExecutablePath:       collector.ExecutablePath,
+			ExecuteParameters:    collector.ExecuteParameters,
+			ValidationParameters: collector.ValidationParameters,
+			VersionParameters:    collector.VersionParameters,
+		}
+		backend := backends.BackendFromResponse(response, assignment.ConfigurationId, ctx)
+		backend.Local = true
+		backendList = append(backendList, *backend)
+	}
+	return backendList
+}
+
+// Template reads the template file of a local configuration
+func (d *Definitions) Template(configurationId string) (string, error) {
+	configuration, ok := d.configurations[configurationId]
+	if !ok {
+		return "", fmt.Errorf("unknown configuration %q", configurationId)
+	}
+	template, err := os.ReadFile(configuration.TemplateFile)
+	if err != nil {
+		return "", fmt.Errorf("can not read template file: %v", err)
+	}
+	return string(template), nil
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/context"
+)
+
+func TestLoadMergesDropIns(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "filebeat.yml")
+	if err := os.WriteFile(template, []byte("filebeat.inputs: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dropInDir := filepath.Join(dir, "sidecar.d")
+	if err := os.Mkdir(dropInDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	dropIn := "configurations:\n" +
+		"  - id: syslog\n" +
+		"    template_file: " + template + "\n" +
+		"assignments:\n" +
+		"  - collector_id: filebeat\n" +
+		"    configuration_id: syslog\n" +
+		"  - collector_id: unknown\n" +
+		"    configuration_id: syslog\n"
+	if err := os.WriteFile(filepath.Join(dropInDir, "10-syslog.yml"), []byte(dropIn), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dropInDir, "README"), []byte("not yaml: ["), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &context.Ctx{UserConfig: &cfgfile.SidecarConfig{
+		CollectorConfigurationDirectory: filepath.Join(dir, "generated"),
+		LocalDefinitionsDirectory:       dropInDir,
+		LocalDefinitions: cfgfile.LocalDefinitions{
+			Collectors: []cfgfile.LocalCollector{{
+				Id:                "filebeat",
+				Name:              "filebeat",
+				ExecutablePath:    "/usr/bin/filebeat",
+				ExecuteParameters: "-c %s",
+			}},
+		},
+	}}
+
+	definitions, err := Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(definitions.Assignments()) != 1 {
+		t.Fatalf("expected the assignment with the unknown collector to be skipped: %v", definitions.Assignments())
+	}
+
+	backendList := definitions.Backends(ctx)
+	if len(backendList) != 1 {
+		t.Fatalf("expected one backend, got %d", len(backendList))
+	}
+	backend := backendList[0]
+	if !backend.Local {
+		t.Errorf("backends from local definitions should be marked as local")
+	}
+	if backend.ServiceType != "exec" {
+		t.Errorf("service type should default to exec, got %q", backend.ServiceType)
+	}
+	expectedPath := filepath.Join(dir, "generated", "syslog", "filebeat.conf")
+	if backend.ConfigurationPath != expectedPath {
+		t.Errorf("expected configuration path %s, got %s", expectedPath, backend.ConfigurationPath)
+	}
+
+	content, err := definitions.Template("syslog")
+	if err != nil || content != "filebeat.inputs: []\n" {
+		t.Fatalf("unexpected template %q: %v", content, err)
+	}
+}
@@ -16,15 +16,19 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/kardianos/service"
 	"github.com/sirupsen/logrus"
 
+	"github.com/Graylog2/collector-sidecar/api"
+	"github.com/Graylog2/collector-sidecar/api/rest"
 	"github.com/Graylog2/collector-sidecar/cfgfile"
 	"github.com/Graylog2/collector-sidecar/common"
 	"github.com/Graylog2/collector-sidecar/context"
@@ -32,6 +36,7 @@ import (
 	"github.com/Graylog2/collector-sidecar/logger"
 	"github.com/Graylog2/collector-sidecar/logger/hooks"
 	"github.com/Graylog2/collector-sidecar/services"
+	"github.com/Graylog2/collector-sidecar/update"
 
 	// importing backend packages to ensure init() is called
 	_ "github.com/Graylog2/collector-sidecar/daemon"
@@ -42,11 +47,13 @@ var (
 	printVersion      *bool
 	debug             *bool
 	serviceParam      *string
+	enrollmentToken   *string
 	configurationFile *string
 )
 
 func init() {
 	serviceParam = flag.String("service", "", "Control the system service [start stop restart install uninstall]")
+	enrollmentToken = flag.String("enroll", "", "Enroll this node with a one-time enrollment token and exit. Use - to read the token from stdin")
 	configurationFile = flag.String("c", common.ConfigFilePath(), "Configuration file")
 	printVersion = flag.Bool("version", false, "Print version and exit")
 	debug = flag.Bool("debug", false, "Set log level to debug")
@@ -88,8 +95,14 @@ func main() {
 		return
 	}
 
+	// a new version that fails before it can register is rolled back here, the configuration may be the cause
+	if !cfgfile.ValidateConfig() && len(*enrollmentToken) == 0 {
+		update.RollbackFailedUpdate()
+	}
+
 	// initialize application context
 	ctx := context.NewContext()
+	ctx.Enrolling = len(*enrollmentToken) != 0
 	err = ctx.LoadConfig(configurationFile)
 	if err != nil {
 		fmt.Println(err.Error())
@@ -98,6 +111,12 @@ func main() {
 		// Persist path for later reloads
 		cfgfile.SetConfigPath(*configurationFile)
 	}
+	if ctx.Enrolling {
+		if err := enroll(ctx); err != nil {
+			log.Fatalf("Enrollment failed: %v", err)
+		}
+		return
+	}
 	if cfgfile.ValidateConfig() {
 		// if ctx.LoadConfig didn't fail already print message and exit
 		fmt.Println("Config OK")
@@ -113,6 +132,8 @@ func main() {
 	hooks.AddLogHooks(ctx, log)
 
 	// start main loop
+	services.StartSelfUpdate(ctx, services.RestartService(s, distributor))
+	services.StartCollectorInstall(ctx)
 	services.StartPeriodicals(ctx)
 	err = s.Run()
 	if err != nil {
@@ -141,3 +162,20 @@ func commandLineSetup() error {
 
 	return nil
 }
+
+// exchange the enrollment token for node credentials which are used by the next start
+func enroll(ctx *context.Ctx) error {
+	if ctx.UserConfig.Standalone {
+		return errors.New("enrollment is not possible in standalone mode")
+	}
+	token := *enrollmentToken
+	if token == "-" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("can't read enrollment token from stdin: %v", err)
+		}
+		token = strings.TrimSpace(line)
+	}
+	httpClient := rest.NewHTTPClient(api.GetTlsConfig(ctx))
+	return api.EnrollNode(api.NewEnrollmentClient(httpClient, ctx), token, context.NodeCredentialsPath(), ctx)
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	nxlogOutputStart = regexp.MustCompile(`(?i)^\s*<Output\b`)
+	nxlogOutputEnd   = regexp.MustCompile(`(?i)^\s*</Output>`)
+	nxlogHost        = regexp.MustCompile(`(?i)^\s*(Host|URL)\s+(\S+)`)
+	nxlogModule      = regexp.MustCompile(`(?i)^\s*Module\s+(\S+)`)
+	nxlogInclude     = regexp.MustCompile(`(?i)^\s*include(_stdout)?\s`)
+)
+
+// output modules and types whose destinations are known, every other output is rejected by
+// `allowed_output_hosts` because its destination can't be checked
+var (
+	nxlogOutputModules = map[string]bool{
+		"om_tcp":           true,
+		"om_udp":           true,
+		"om_udpspoof":      true,
+		"om_ssl":           true,
+		"om_http":          true,
+		"om_elasticsearch": true,
+		"om_batchcompress": true,
+	}
+	beatsOutputTypes = map[string]bool{
+		"elasticsearch": true,
+		"logstash":      true,
+		"kafka":         true,
+		"redis":         true,
+	}
+)
+
+func init() {
+	RegisterCheck("deny_patterns", checkDenyPatterns)
+	RegisterCheck("require_patterns", checkRequirePatterns)
+	RegisterCheck("allowed_output_hosts", checkOutputHosts)
+}
+
+func checkDenyPatterns(rule *Rule, collectorName string, template string) error {
+	for _, re := range rule.DenyPatterns {
+		if re.MatchString(template) {
+			return fmt.Errorf("configuration matches denied pattern %q", re.String())
+		}
+	}
+	return nil
+}
+
+func checkRequirePatterns(rule *Rule, collectorName string, template string) error {
+	for _, re := range rule.RequirePatterns {
+		if !re.MatchString(template) {
+			return fmt.Errorf("configuration does not match required pattern %q", re.String())
+		}
+	}
+	return nil
+}
+
+func checkOutputHosts(rule *Rule, collectorName string, template string) error {
+	if len(rule.AllowedOutputHosts) == 0 {
+		return nil
+	}
+	hosts, err := OutputHosts(collectorName, template)
+	if err != nil {
+		return fmt.Errorf("can't determine output hosts: %v", err)
+	}
+	for _, host := range hosts {
+		if !hostAllowed(rule.AllowedOutputHosts, host) {
+			return fmt.Errorf("output host %q is not allowed", host)
+		}
+	}
+	return nil
+}
+
+// OutputHosts extracts the destinations of a collector configuration. NXLog configurations are
+// recognized by the collector name, everything else is parsed as Beats YAML configuration.
+// An error is returned if any destination of the configuration can't be determined.
+func OutputHosts(collectorName string, template string) ([]string, error) {
+	if strings.Contains(strings.ToLower(collectorName), "nxlog") {
+		return nxlogOutputHosts(template)
+	}
+	return beatsOutputHosts(template)
+}
+
+// Host and URL directives of all <Output> blocks
+func nxlogOutputHosts(template string) ([]string, error) {
+	var hosts []string
+	var module string
+	var blockHosts int
+	inOutput := false
+	for _, line := range strings.Split(template, "\n") {
+		switch {
+		case nxlogInclude.MatchString(line):
+			return nil, fmt.Errorf("included configurations can't be checked")
+		case nxlogOutputStart.MatchString(line):
+			inOutput = true
+			module = ""
+			blockHosts = 0
+		case nxlogOutputEnd.MatchString(line):
+			inOutput = false
+			if !nxlogOutputModules[strings.ToLower(module)] {
+				return nil, fmt.Errorf("unknown output module %q", module)
+			}
+			if blockHosts == 0 {
+				return nil, fmt.Errorf("output module %s has no Host or URL", module)
+			}
+		case inOutput:
+			if match := nxlogModule.FindStringSubmatch(line); match != nil {
+				module = match[1]
+			}
+			if match := nxlogHost.FindStringSubmatch(line); match != nil {
+				hosts = append(hosts, match[2])
+				blockHosts++
+			}
+		}
+	}
+	if inOutput {
+		return nil, fmt.Errorf("unterminated <Output> block")
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no output is configured")
+	}
+	return hosts, nil
+}
+
+// the `hosts` settings of all outputs, dotted keys are supported
+func beatsOutputHosts(template string) ([]string, error) {
+	var config map[interface{}]interface{}
+	if err := yaml.Unmarshal([]byte(template), &config); err != nil {
+		return nil, err
+	}
+	settings := make(map[string]interface{})
+	flattenSettings(config, "", settings)
+	if _, ok := settings["cloud.id"]; ok {
+		return nil, fmt.Errorf("the destination of cloud.id can't be checked")
+	}
+
+	outputs := make(map[string]bool)
+	for key := range settings {
+		if strings.HasPrefix(key, "output.") {
+			outputs[strings.SplitN(key, ".", 3)[1]] = true
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no output is configured")
+	}
+	var hosts []string
+	for output := range outputs {
+		if !beatsOutputTypes[output] {
+			return nil, fmt.Errorf("unknown output type %q", output)
+		}
+		var outputHosts []string
+		switch value := settings["output."+output+".hosts"].(type) {
+		case []interface{}:
+			for _, host := range value {
+				outputHosts = append(outputHosts, fmt.Sprint(host))
+			}
+		case nil:
+		default:
+			outputHosts = append(outputHosts, fmt.Sprint(value))
+		}
+		if len(outputHosts) == 0 {
+			return nil, fmt.Errorf("output %s has no hosts", output)
+		}
+		hosts = append(hosts, outputHosts...)
+	}
+	return hosts, nil
+}
+
+// flattenSettings maps every setting to its dotted key, lists are kept as values
+func flattenSettings(node interface{}, prefix string, settings map[string]interface{}) {
+	config, ok := node.(map[interface{}]interface{})
+	if !ok {
+		settings[prefix] = node
+		return
+	}
+	for k, v := range config {
+		flattenSettings(v, strings.TrimPrefix(prefix+"."+fmt.Sprint(k), "."), settings)
+	}
+}
+
+// patterns match either the full address or the host name without scheme and port
+func hostAllowed(patterns []string, host string) bool {
+	address := host
+	if i := strings.Index(address, "://"); i >= 0 {
+		address = address[i+3:]
+	}
+	if i := strings.Index(address, "/"); i >= 0 {
+		address = address[:i]
+	}
+	hostname := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		hostname = h
+	}
+	return matchAny(patterns, host) || matchAny(patterns, address) || matchAny(patterns, hostname)
+}
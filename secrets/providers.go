@@ -0,0 +1,101 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/helpers"
+)
+
+const commandTimeout = 10 * time.Second
+
+// FileProvider reads each secret from a file named like the secret
+type FileProvider struct {
+	Directory string
+}
+
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+func (p *FileProvider) Lookup(name string) (string, bool, error) {
+	content, err := os.ReadFile(filepath.Join(p.Directory, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return trimLineBreak(string(content)), true, nil
+}
+
+// EnvProvider reads secrets from environment variables named <prefix><name>
+type EnvProvider struct {
+	Prefix string
+}
+
+func (p *EnvProvider) Name() string {
+	return "env"
+}
+
+func (p *EnvProvider) Lookup(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(p.Prefix + name)
+	return value, ok, nil
+}
+
+// CommandProvider runs a credential helper with the secret name as last argument and
+// uses its output as secret value. Exit code 2 means the secret is unknown to the helper.
+type CommandProvider struct {
+	Command string
+}
+
+func (p *CommandProvider) Name() string {
+	return "command"
+}
+
+func (p *CommandProvider) Lookup(name string) (string, bool, error) {
+	args, err := helpers.SplitCommandLine(p.Command)
+	if err != nil || len(args) == 0 {
+		return "", false, fmt.Errorf("invalid command %q", p.Command)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], name)...)
+	cmd.Stdout = &stdout
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return "", false, nil
+	} else if err != nil {
+		// the output is not part of the error, it might contain the secret
+		return "", false, err
+	}
+	return trimLineBreak(stdout.String()), true, nil
+}
+
+func trimLineBreak(value string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(value, "\n"), "\r")
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package secrets
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Graylog2/collector-sidecar/logger"
+)
+
+const (
+	// Redacted replaces resolved secret values
+	Redacted = "[REDACTED]"
+	// lines of multi-line values shorter than this, like "}" or "", would garble every log line
+	minLineRedactionLength = 6
+)
+
+var (
+	log            = logger.Log()
+	redactionMutex sync.RWMutex
+	redactions     = make(map[string]bool)
+	// rebuilt when a value is added, log messages are redacted with a single pass
+	redactor *strings.Replacer
+)
+
+// AddRedaction registers a resolved secret which must not show up in logs or status messages.
+// The whole value is always redacted. Each line of multi-line values, like TLS keys, is redacted
+// on its own as well, except for short lines and PEM armor lines.
+func AddRedaction(value string) {
+	if value == "" {
+		return
+	}
+	values := []string{value}
+	if strings.Contains(value, "\n") {
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) >= minLineRedactionLength && !strings.HasPrefix(line, "-----") {
+				values = append(values, line)
+			}
+		}
+	}
+
+	redactionMutex.Lock()
+	added := false
+	for _, v := range values {
+		if !redactions[v] {
+			redactions[v] = true
+			added = true
+		}
+	}
+	if added {
+		redactor = newRedactor()
+	}
+	redactionMutex.Unlock()
+
+	// logged without the lock, the log hook redacts the message
+	if added && len(value) < minLineRedactionLength {
+		log.Warnf("A resolved secret is shorter than %d characters, these characters are redacted everywhere", minLineRedactionLength)
+	}
+}
+
+func newRedactor() *strings.Replacer {
+	values := make([]string, 0, len(redactions))
+	for value := range redactions {
+		values = append(values, value)
+	}
+	// replace longer values first, they may contain shorter ones
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, value := range values {
+		pairs = append(pairs, value, Redacted)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// Redact replaces all resolved secret values in text
+func Redact(text string) string {
+	redactionMutex.RLock()
+	defer redactionMutex.RUnlock()
+	if redactor == nil || text == "" {
+		return text
+	}
+	return redactor.Replace(text)
+}
+
+// LogHook redacts secret values from all log messages
+type LogHook struct{}
+
+func (h LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h LogHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package secrets
+
+import (
+	"fmt"
+
+	"github.com/Graylog2/collector-sidecar/common"
+)
+
+// Provider looks up secrets in a local source. It returns false if it doesn't know the secret.
+type Provider interface {
+	Name() string
+	Lookup(name string) (string, bool, error)
+}
+
+// Resolver looks up `${secret:name}` references with the first provider knowing them
+type Resolver struct {
+	providers []Provider
+}
+
+func NewResolver(providers ...Provider) *Resolver {
+	return &Resolver{providers: providers}
+}
+
+// Resolve returns the value of a single secret and registers it for redaction
+func (r *Resolver) Resolve(name string) (string, error) {
+	value, err := r.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	AddRedaction(value)
+	return value, nil
+}
+
+func (r *Resolver) lookup(name string) (string, error) {
+	if err := common.ValidatePathElement(name); err != nil {
+		return "", fmt.Errorf("invalid secret name %q: %v", name, err)
+	}
+	if r == nil || len(r.providers) == 0 {
+		return "", fmt.Errorf("secret %q is referenced, but no secret provider is configured", name)
+	}
+	for _, provider := range r.providers {
+		value, ok, err := provider.Lookup(name)
+		if err != nil {
+			return "", fmt.Errorf("%s secret provider failed to resolve %q: %v", provider.Name(), name, err)
+		}
+		if ok {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("secret %q not found", name)
+}
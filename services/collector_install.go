@@ -0,0 +1,109 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package services
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/api"
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/api/rest"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/daemon"
+	"github.com/Graylog2/collector-sidecar/download"
+	"github.com/Graylog2/collector-sidecar/install"
+)
+
+var (
+	collectorInstaller *install.Installer
+	// downloads may take longer than the update interval, skip packages while an install is running
+	collectorInstallRunning sync.Mutex
+	// install paths of new binaries, the collectors are restarted by the periodicals loop which owns the runners
+	changedCollectorPathsMutex sync.Mutex
+	changedCollectorPaths      []string
+)
+
+// StartCollectorInstall enables installing collector binaries and watches the manifest URL
+func StartCollectorInstall(context *context.Ctx) {
+	config := context.UserConfig.CollectorInstall
+	if !config.Enabled {
+		return
+	}
+	publicKey, err := download.ParsePublicKey(config.PublicKey)
+	if err != nil {
+		log.Errorf("[CollectorInstall] Not installing collectors: %v", err)
+		return
+	}
+	collectorInstaller = install.NewInstaller(config.Directory, context.UserConfig.CollectorBinariesAccesslist, publicKey)
+	if config.ManifestUrl == "" {
+		return
+	}
+	go func() {
+		for {
+			httpClient := rest.NewHTTPClient(api.GetTlsConfig(context))
+			var packages []graylog.ResponseCollectorPackage
+			if err := download.JSON(httpClient, config.ManifestUrl, &packages); err != nil {
+				log.Errorf("[CollectorInstall] Failed to fetch collector manifest: %v", err)
+			} else {
+				applyCollectorPackages(httpClient, packages)
+			}
+			time.Sleep(config.CheckInterval)
+		}
+	}()
+}
+
+// install collector packages advertised by the server in the background
+func handleCollectorPackages(context *context.Ctx, packages []graylog.ResponseCollectorPackage) {
+	if collectorInstaller == nil || len(packages) == 0 {
+		return
+	}
+	go applyCollectorPackages(rest.NewHTTPClient(api.GetTlsConfig(context)), packages)
+}
+
+func applyCollectorPackages(httpClient *http.Client, packages []graylog.ResponseCollectorPackage) {
+	if !collectorInstallRunning.TryLock() {
+		return
+	}
+	defer collectorInstallRunning.Unlock()
+
+	changed, err := collectorInstaller.Apply(httpClient, packages)
+	if err != nil {
+		log.Errorf("[CollectorInstall] %v", err)
+	}
+	changedCollectorPathsMutex.Lock()
+	changedCollectorPaths = append(changedCollectorPaths, changed...)
+	changedCollectorPathsMutex.Unlock()
+}
+
+// running collectors keep the old binary open and collectors waiting for a missing binary
+// need a new start, restart all collectors using a changed path
+func restartChangedCollectors() {
+	changedCollectorPathsMutex.Lock()
+	paths := changedCollectorPaths
+	changedCollectorPaths = nil
+	changedCollectorPathsMutex.Unlock()
+
+	for _, path := range paths {
+		for _, runner := range daemon.Daemon.Runner {
+			if runner.GetBackend().ExecutablePath == path {
+				log.Infof("[%s] Restarting to use the new collector binary", runner.Name())
+				runner.Restart()
+			}
+		}
+	}
+}
@@ -17,6 +17,7 @@ package services
 
 import (
 	"net/http"
+	"reflect"
 	"time"
 
 	"github.com/Graylog2/collector-sidecar/api"
@@ -24,8 +25,10 @@ import (
 	"github.com/Graylog2/collector-sidecar/api/rest"
 	"github.com/Graylog2/collector-sidecar/assignments"
 	"github.com/Graylog2/collector-sidecar/backends"
+	"github.com/Graylog2/collector-sidecar/common"
 	"github.com/Graylog2/collector-sidecar/context"
 	"github.com/Graylog2/collector-sidecar/daemon"
+	"github.com/Graylog2/collector-sidecar/local"
 	"github.com/Graylog2/collector-sidecar/logger"
 )
 
@@ -34,13 +37,20 @@ const reCreateHttpConnEvery = 60
 var log = logger.Log()
 
 func StartPeriodicals(context *context.Ctx) {
+	if context.UserConfig.Standalone {
+		startStandalonePeriodicals(context)
+		return
+	}
+	// CPU usage is reported as average over a fixed window, independent of update_interval
+	common.StartCpuSampler()
 
 	go func() {
 		var httpClient *http.Client
 
-		configChecksums := make(map[string]string)
+		configChecksums := make(map[assignments.BackendKey]string)
 		var lastBackendResponse graylog.ResponseBackendList
 		var lastRegResponse graylog.ResponseCollectorRegistration
+		localDefinitions := local.NewDefinitions()
 		logOnce := true
 		iteration := 0
 
@@ -54,6 +64,15 @@ func StartPeriodicals(context *context.Ctx) {
 			}
 			iteration++
 
+			// locally defined collectors are managed even if the server is not reachable
+			definitions := reloadLocalDefinitions(localDefinitions, context)
+			if !reflect.DeepEqual(definitions, localDefinitions) {
+				localDefinitions = definitions
+				updateStores(lastRegResponse, lastBackendResponse, localDefinitions, context)
+			}
+			applyLocalConfigurations(localDefinitions, context)
+			restartChangedCollectors()
+
 			serverVersion, err := api.GetServerVersion(httpClient, context)
 			if err != nil {
 				continue
@@ -67,6 +86,8 @@ func StartPeriodicals(context *context.Ctx) {
 			if !regResponse.NotModified {
 				lastRegResponse = regResponse
 			}
+			handleSelfUpdate(context, &regResponse)
+			handleCollectorPackages(context, lastRegResponse.CollectorPackages)
 
 			// backend list is needed before configuration assignments are updated
 			backendResponse, err := fetchBackendList(httpClient, lastBackendResponse.Checksum, context)
@@ -78,37 +99,26 @@ func StartPeriodicals(context *context.Ctx) {
 			}
 
 			if !regResponse.NotModified || !backendResponse.NotModified {
-				modified := assignments.Store.Update(lastRegResponse.Assignments)
-
-				backendList := []backends.Backend{}
-				// TODO this is inefficient
-				for _, assignment := range lastRegResponse.Assignments {
-					configId := assignment.ConfigurationId
-					for _, backend := range lastBackendResponse.Backends {
-						if backend.Id == assignment.BackendId {
-							backendList = append(backendList, *backends.BackendFromResponse(backend, configId, context))
-						}
-					}
-				}
-				backends.Store.Update(backendList)
+				modified := updateStores(lastRegResponse, lastBackendResponse, localDefinitions, context)
 
 				// regResponse.NotModified is always false, because graylog does not implement caching yet.
 				// Thus, we need to double-check.
 				if modified || !backendResponse.NotModified {
-					configChecksums = make(map[string]string)
+					configChecksums = make(map[assignments.BackendKey]string)
 				}
-				// create process instances
-				daemon.Daemon.SyncWithAssignments(context)
-				// test for new or updated configurations and start the corresponding collector
-				if assignments.Store.Len() == 0 {
-					if logOnce {
-						log.Info("No configurations assigned to this instance. Skipping configuration request.")
-						logOnce = false
-					}
-					continue
-				} else {
-					logOnce = true
+			}
+			// remove configuration files of collectors that are not assigned anymore
+			backends.Store.CleanupConfigurations(context)
+
+			// test for new or updated configurations and start the corresponding collector
+			if assignments.Store.Len() == 0 {
+				if logOnce {
+					log.Info("No configurations assigned to this instance. Skipping configuration request.")
+					logOnce = false
 				}
+				continue
+			} else {
+				logOnce = true
 			}
 			log.Debugf("backend store %v", *backends.Store)
 			log.Debugf("assignments store %v", assignments.Store.GetAll())
@@ -118,6 +128,47 @@ func StartPeriodicals(context *context.Ctx) {
 	}()
 }
 
+// merge server and local assignments into the stores and create process instances
+func updateStores(
+	regResponse graylog.ResponseCollectorRegistration,
+	backendResponse graylog.ResponseBackendList,
+	localDefinitions *local.Definitions,
+	context *context.Ctx) bool {
+	assignments.Store.SetLocalAssignments(localDefinitions.Assignments())
+	modified := assignments.Store.Update(regResponse.Assignments)
+
+	backendList := []backends.Backend{}
+	// TODO this is inefficient
+	for _, assignment := range regResponse.Assignments {
+		configId := assignment.ConfigurationId
+		if assignments.Store.IsLocal(assignments.NewBackendKey(assignment.BackendId, configId)) {
+			// local definitions take precedence
+			continue
+		}
+		for _, backend := range backendResponse.Backends {
+			if backend.Id == assignment.BackendId {
+				backendList = append(backendList, *backends.BackendFromResponse(backend, configId, context))
+			}
+		}
+	}
+	backendList = append(backendList, localDefinitions.Backends(context)...)
+	backends.Store.Update(backendList)
+
+	// create process instances
+	daemon.Daemon.SyncWithAssignments(context)
+	return modified
+}
+
+// keep the last valid local definitions if they can't be loaded
+func reloadLocalDefinitions(current *local.Definitions, context *context.Ctx) *local.Definitions {
+	definitions, err := local.Load(context)
+	if err != nil {
+		log.Errorf("Failed to load local definitions, keeping the previous ones: %v", err)
+		return current
+	}
+	return definitions
+}
+
 // report collector status to Graylog server and receive assignments
 func updateCollectorRegistration(httpClient *http.Client, checksum string, context *context.Ctx, serverVersion *api.GraylogVersion) (graylog.ResponseCollectorRegistration, error) {
 	statusRequest := api.NewStatusRequest(serverVersion)
@@ -134,8 +185,11 @@ func fetchBackendList(httpClient *http.Client, checksum string, ctx *context.Ctx
 }
 
 // fetch configuration periodically
-func checkForUpdateAndRestart(httpClient *http.Client, checksums map[string]string, context *context.Ctx) {
+func checkForUpdateAndRestart(httpClient *http.Client, checksums map[assignments.BackendKey]string, context *context.Ctx) {
 	for backendId, configurationId := range assignments.Store.GetAll() {
+		if assignments.Store.IsLocal(backendId) {
+			continue
+		}
 		runner := daemon.Daemon.GetRunnerByBackendId(backendId)
 		if runner == nil {
 			log.Errorf("Got collector ID with no existing instance, skipping configuration check: %s", backendId)
@@ -154,22 +208,51 @@ func checkForUpdateAndRestart(httpClient *http.Client, checksums map[string]stri
 		}
 		checksums[backendId] = response.Checksum
 
-		if backend.RenderOnChange(backends.Backend{Template: response.Template}, context) {
-			if err, output := backend.ValidateConfigurationFile(context); err != nil {
-				backend.SetStatusLogErrorf(err.Error())
-				if output != "" {
-					log.Errorf("[%s] Validation command output: %s", backend.Name, output)
-					backend.SetVerboseStatus(output)
-				}
-				continue
-			}
+		applyConfiguration(backend, response.Template, context)
+		if backend.Template != response.Template {
+			// the configuration wasn't written, fetch it again with the next update
+			delete(checksums, backendId)
+		}
+	}
+}
+
+// render the template files of locally assigned configurations
+func applyLocalConfigurations(localDefinitions *local.Definitions, context *context.Ctx) {
+	for backendId, configurationId := range assignments.Store.GetAll() {
+		if !assignments.Store.IsLocal(backendId) {
+			continue
+		}
+		runner := daemon.Daemon.GetRunnerByBackendId(backendId)
+		if runner == nil {
+			log.Errorf("Got collector ID with no existing instance, skipping configuration check: %s", backendId)
+			continue
+		}
+		backend := runner.GetBackend()
+		template, err := localDefinitions.Template(configurationId)
+		if err != nil {
+			backend.SetStatusLogErrorf("Can't load local configuration: %s", err)
+			continue
+		}
+		applyConfiguration(backend, template, context)
+	}
+}
 
-			if err := daemon.Daemon.Runner[backend.Id].Restart(); err != nil {
-				msg := "Failed to restart collector"
-				backend.SetStatus(backends.StatusError, msg, "")
-				log.Errorf("[%s] %s: %v", backend.Name, msg, err)
+// write a changed configuration, validate it and restart the collector
+func applyConfiguration(backend *backends.Backend, template string, context *context.Ctx) {
+	if backend.RenderOnChange(backends.Backend{Template: template}, context) {
+		if err, output := backend.ValidateConfigurationFile(context); err != nil {
+			backend.SetStatusLogErrorf("%s", err)
+			if output != "" {
+				log.Errorf("[%s] Validation command output: %s", backend.Name, output)
+				backend.SetVerboseStatus(output)
 			}
+			return
+		}
 
+		if err := daemon.Daemon.Runner[backend.Id].Restart(); err != nil {
+			msg := "Failed to restart collector"
+			backend.SetStatus(backends.StatusError, msg, "")
+			log.Errorf("[%s] %s: %v", backend.Name, msg, err)
 		}
 	}
 }
@@ -0,0 +1,37 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+//go:build darwin || linux || solaris || freebsd
+
+package services
+
+import (
+	"errors"
+
+	"github.com/kardianos/service"
+
+	"github.com/Graylog2/collector-sidecar/daemon"
+)
+
+// RestartService returns a function that lets the service manager restart the sidecar
+func RestartService(s service.Service, distributor *daemon.Distributor) func() error {
+	return func() error {
+		if service.Interactive() {
+			return errors.New("not running as a service, the new version is active after a manual restart")
+		}
+		// the service manager owns the restart job, it stops this process before starting the new binary
+		return s.Restart()
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package services
+
+import (
+	"errors"
+	"os"
+
+	"github.com/kardianos/service"
+
+	"github.com/Graylog2/collector-sidecar/daemon"
+)
+
+// RestartService returns a function that restarts the sidecar through the failure actions of the
+// Windows service. A service can't restart itself through the SCM because stopping blocks until
+// this process is gone.
+func RestartService(s service.Service, distributor *daemon.Distributor) func() error {
+	return func() error {
+		if service.Interactive() {
+			return errors.New("not running as a service, the new version is active after a manual restart")
+		}
+		distributor.Stop(s)
+		log.Info("Exiting to let the service recovery start the new version")
+		os.Exit(1)
+		return nil
+	}
+}
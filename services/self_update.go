@@ -0,0 +1,59 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package services
+
+import (
+	"github.com/Graylog2/collector-sidecar/api"
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/api/rest"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/update"
+)
+
+var selfUpdater *update.Updater
+
+// StartSelfUpdate checks a pending update and watches the manifest URL, restart is called after the
+// sidecar binary was replaced
+func StartSelfUpdate(context *context.Ctx, restart func() error) {
+	if !context.UserConfig.SelfUpdate.Enabled || context.UserConfig.Standalone {
+		return
+	}
+	updater, err := update.NewUpdater(context, restart)
+	if err != nil {
+		log.Errorf("[SelfUpdate] Disabled: %v", err)
+		return
+	}
+	selfUpdater = updater
+	selfUpdater.Start(rest.NewHTTPClient(api.GetTlsConfig(context)))
+}
+
+// a successful registration confirms a pending update, the response may advertise a new version
+func handleSelfUpdate(context *context.Ctx, regResponse *graylog.ResponseCollectorRegistration) {
+	if selfUpdater == nil {
+		return
+	}
+	selfUpdater.Confirm()
+	if regResponse.SelfUpdate == nil {
+		return
+	}
+	manifest := regResponse.SelfUpdate
+	go func() {
+		httpClient := rest.NewHTTPClient(api.GetTlsConfig(context))
+		if err := selfUpdater.Apply(httpClient, manifest); err != nil {
+			log.Errorf("[SelfUpdate] %v", err)
+		}
+	}()
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package services
+
+import (
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/assignments"
+	"github.com/Graylog2/collector-sidecar/backends"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/local"
+	"github.com/Graylog2/collector-sidecar/system"
+)
+
+// In standalone mode collectors, configurations and assignments are only taken from the
+// local definitions. The server is never contacted.
+func startStandalonePeriodicals(context *context.Ctx) {
+	log.Info("Running in standalone mode, using local collector definitions only")
+
+	go func() {
+		logOnce := true
+		iteration := 0
+
+		for {
+			if iteration > 0 {
+				time.Sleep(time.Duration(context.UserConfig.UpdateInterval) * time.Second)
+			}
+			iteration++
+
+			definitions, err := local.Load(context)
+			if err != nil {
+				msg := "Failed to load local definitions"
+				system.GlobalStatus.Set(backends.StatusError, msg)
+				log.Errorf("[Standalone] %s: %v", msg, err)
+				continue
+			}
+			system.GlobalStatus.Set(backends.StatusRunning, "")
+
+			updateStores(graylog.ResponseCollectorRegistration{}, graylog.ResponseBackendList{}, definitions, context)
+			backends.Store.CleanupConfigurations(context)
+			restartChangedCollectors()
+
+			if assignments.Store.Len() == 0 {
+				if logOnce {
+					log.Info("No local configurations assigned to this instance.")
+					logOnce = false
+				}
+				continue
+			}
+			logOnce = true
+
+			applyLocalConfigurations(definitions, context)
+		}
+	}()
+}
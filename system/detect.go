@@ -0,0 +1,76 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package system
+
+import (
+	"strings"
+)
+
+// markers in /proc/1/cgroup of the init process inside a container
+var cgroupContainerMarkers = []struct {
+	marker    string
+	container string
+}{
+	{"kubepods", "kubernetes"},
+	{"docker", "docker"},
+	{"libpod", "podman"},
+	{"containerd", "containerd"},
+	{"lxc", "lxc"},
+}
+
+// DMI vendor and product strings of common hypervisors
+var dmiVirtualizationMarkers = []struct {
+	marker         string
+	virtualization string
+}{
+	{"vmware", "vmware"},
+	{"virtualbox", "virtualbox"},
+	{"innotek", "virtualbox"},
+	{"kvm", "kvm"},
+	{"qemu", "qemu"},
+	{"xen", "xen"},
+	{"amazon ec2", "amazon"},
+	{"google compute engine", "google"},
+	{"parallels", "parallels"},
+	{"bochs", "bochs"},
+}
+
+func containerFromCgroup(cgroup string) string {
+	for _, line := range strings.Split(cgroup, "\n") {
+		for _, m := range cgroupContainerMarkers {
+			if strings.Contains(line, m.marker) {
+				return m.container
+			}
+		}
+	}
+	return ""
+}
+
+// virtualizationFromDmi guesses the hypervisor from the system vendor and product name
+func virtualizationFromDmi(vendor string, product string) string {
+	vendor = strings.ToLower(vendor)
+	product = strings.ToLower(product)
+	// Hyper-V and Azure report Microsoft as vendor, physical Surface devices do as well
+	if strings.Contains(vendor, "microsoft") && strings.Contains(product, "virtual machine") {
+		return "hyperv"
+	}
+	for _, m := range dmiVirtualizationMarkers {
+		if strings.Contains(vendor, m.marker) || strings.Contains(product, m.marker) {
+			return m.virtualization
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package system
+
+import (
+	"os"
+	"strings"
+
+	"github.com/Graylog2/collector-sidecar/common"
+)
+
+func kernelRelease() string {
+	return readFirstLine("/proc/sys/kernel/osrelease")
+}
+
+func detectContainer() string {
+	if common.FileExists("/.dockerenv") == nil {
+		return "docker"
+	}
+	if common.FileExists("/run/.containerenv") == nil {
+		return "podman"
+	}
+	if content, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+		if container := containerFromCgroup(string(content)); container != "" {
+			return container
+		}
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+	return ""
+}
+
+func detectVirtualization() string {
+	return virtualizationFromDmi(readFirstLine("/sys/class/dmi/id/sys_vendor"),
+		readFirstLine("/sys/class/dmi/id/product_name"))
+}
+
+func readFirstLine(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(content), "\n")
+	return strings.TrimSpace(line)
+}
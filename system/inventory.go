@@ -16,11 +16,33 @@
 package system
 
 import (
-	"github.com/Graylog2/collector-sidecar/common"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Graylog2/collector-sidecar/common"
 )
 
+// os-release IDs of the platform families reported by LinuxPlatform
+var linuxPlatformFamilies = []string{"debian", "rhel", "fedora", "suse", "gentoo", "slackware", "arch", "alpine"}
+
 type Inventory struct {
+	once    sync.Once
+	details Details
+}
+
+// Details describes the operating system and runtime environment of the node.
+// Values which can't be detected are empty.
+type Details struct {
+	OsId           string `json:"os_id,omitempty"`
+	OsIdLike       string `json:"os_id_like,omitempty"`
+	OsVersion      string `json:"os_version,omitempty"`
+	OsName         string `json:"os_name,omitempty"`
+	Kernel         string `json:"kernel,omitempty"`
+	Architecture   string `json:"architecture,omitempty"`
+	Container      string `json:"container,omitempty"`
+	Virtualization string `json:"virtualization,omitempty"`
 }
 
 func NewInventory() *Inventory {
@@ -44,9 +66,90 @@ func (inv *Inventory) Windows() bool {
 }
 
 func (inv *Inventory) LinuxPlatform() string {
-	if runtime.GOOS == "linux" {
-		return common.LinuxPlatformFamily()
-	} else {
+	if runtime.GOOS != "linux" {
 		return runtime.GOOS
 	}
+	details := inv.Details()
+	if family := platformFamily(details.OsId, details.OsIdLike); family != "" {
+		return family
+	}
+	return common.LinuxPlatformFamily()
+}
+
+// Details are detected once, they don't change while the sidecar is running
+func (inv *Inventory) Details() Details {
+	inv.once.Do(func() {
+		inv.details = detectDetails(readOsRelease())
+	})
+	return inv.details
+}
+
+// Variables returns the details by the names used for `${inventory:key}` template variables
+func (inv *Inventory) Variables() map[string]string {
+	details := inv.Details()
+	return map[string]string{
+		"os_id":          details.OsId,
+		"os_id_like":     details.OsIdLike,
+		"os_version":     details.OsVersion,
+		"os_name":        details.OsName,
+		"kernel":         details.Kernel,
+		"architecture":   details.Architecture,
+		"container":      details.Container,
+		"virtualization": details.Virtualization,
+	}
+}
+
+// Tags returns the details which are useful for configuration assignments as "<key>:<value>" tags
+func (inv *Inventory) Tags() []string {
+	details := inv.Details()
+	var result []string
+	for key, value := range map[string]string{
+		"os":             details.OsId,
+		"os_version":     details.OsVersion,
+		"architecture":   details.Architecture,
+		"container":      details.Container,
+		"virtualization": details.Virtualization,
+	} {
+		if value != "" {
+			result = append(result, key+":"+strings.ToLower(value))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func detectDetails(osRelease map[string]string) Details {
+	details := Details{
+		OsId:           osRelease["ID"],
+		OsIdLike:       osRelease["ID_LIKE"],
+		OsVersion:      osRelease["VERSION_ID"],
+		OsName:         osRelease["PRETTY_NAME"],
+		Kernel:         kernelRelease(),
+		Architecture:   runtime.GOARCH,
+		Container:      detectContainer(),
+		Virtualization: detectVirtualization(),
+	}
+	if details.OsId == "" {
+		details.OsId = runtime.GOOS
+	}
+	if details.OsName == "" {
+		details.OsName = osRelease["NAME"]
+	}
+	return details
+}
+
+// platformFamily maps the os-release ID and ID_LIKE to the families of common.LinuxPlatformFamily
+func platformFamily(id string, idLike string) string {
+	for _, candidate := range append([]string{id}, strings.Fields(idLike)...) {
+		for _, family := range linuxPlatformFamilies {
+			if candidate != family {
+				continue
+			}
+			if family == "rhel" || family == "fedora" {
+				return "redhat"
+			}
+			return family
+		}
+	}
+	return ""
 }
@@ -0,0 +1,112 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package system
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOsRelease(t *testing.T) {
+	content := `# comment
+NAME="Ubuntu"
+VERSION_ID="22.04"
+ID=ubuntu
+ID_LIKE=debian
+PRETTY_NAME='Ubuntu 22.04.4 LTS'
+HOME_URL="https://www.ubuntu.com/"
+invalid line
+`
+	expected := map[string]string{
+		"NAME":        "Ubuntu",
+		"VERSION_ID":  "22.04",
+		"ID":          "ubuntu",
+		"ID_LIKE":     "debian",
+		"PRETTY_NAME": "Ubuntu 22.04.4 LTS",
+		"HOME_URL":    "https://www.ubuntu.com/",
+	}
+	result := parseOsRelease(strings.NewReader(content))
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestPlatformFamily(t *testing.T) {
+	cases := []struct {
+		id, idLike, family string
+	}{
+		{"ubuntu", "debian", "debian"},
+		{"debian", "", "debian"},
+		{"amzn", "centos rhel fedora", "redhat"},
+		{"fedora", "", "redhat"},
+		{"opensuse-leap", "suse opensuse", "suse"},
+		{"alpine", "", "alpine"},
+		{"nixos", "", ""},
+	}
+	for _, c := range cases {
+		if family := platformFamily(c.id, c.idLike); family != c.family {
+			t.Errorf("%s (%s): expected %q, got %q", c.id, c.idLike, c.family, family)
+		}
+	}
+}
+
+func TestContainerFromCgroup(t *testing.T) {
+	cases := map[string]string{
+		"12:pids:/docker/3f4e2a\n":                            "docker",
+		"11:memory:/kubepods/besteffort/pod1/docker-3f4e2a\n": "kubernetes",
+		"0::/machine.slice/libpod-3f4e2a.scope\n":             "podman",
+		"0::/init.scope\n":                                    "",
+	}
+	for cgroup, expected := range cases {
+		if container := containerFromCgroup(cgroup); container != expected {
+			t.Errorf("%q: expected %q, got %q", cgroup, expected, container)
+		}
+	}
+}
+
+func TestVirtualizationFromDmi(t *testing.T) {
+	cases := []struct {
+		vendor, product, virtualization string
+	}{
+		{"VMware, Inc.", "VMware Virtual Platform", "vmware"},
+		{"QEMU", "Standard PC (Q35 + ICH9, 2009)", "qemu"},
+		{"innotek GmbH", "VirtualBox", "virtualbox"},
+		{"Amazon EC2", "m5.large", "amazon"},
+		{"Microsoft Corporation", "Virtual Machine", "hyperv"},
+		{"Microsoft Corporation", "Surface Laptop 4", ""},
+		{"Dell Inc.", "PowerEdge R740", ""},
+	}
+	for _, c := range cases {
+		if virtualization := virtualizationFromDmi(c.vendor, c.product); virtualization != c.virtualization {
+			t.Errorf("%s %s: expected %q, got %q", c.vendor, c.product, c.virtualization, virtualization)
+		}
+	}
+}
+
+func TestInventoryTags(t *testing.T) {
+	inv := NewInventory()
+	inv.once.Do(func() {})
+	inv.details = Details{OsId: "ubuntu", OsVersion: "22.04", Architecture: "amd64", Virtualization: "kvm"}
+
+	expected := []string{"architecture:amd64", "os:ubuntu", "os_version:22.04", "virtualization:kvm"}
+	if tags := inv.Tags(); !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("expected %v, got %v", expected, tags)
+	}
+	if value := inv.Variables()["os_id"]; value != "ubuntu" {
+		t.Fatalf("expected os_id variable ubuntu, got %q", value)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+	"github.com/Graylog2/collector-sidecar/helpers"
+	"github.com/Graylog2/collector-sidecar/logger"
+)
+
+const commandTimeout = 10 * time.Second
+
+var log = logger.Log()
+
+// Collector merges the static tags of the configuration with tags from tag files,
+// environment variables and commands. Tag files and environment variables are evaluated on
+// every Collect(). Commands run concurrently in the background, Collect() returns the tags of
+// their last run, so slow commands don't delay the registration.
+type Collector struct {
+	mutex          sync.Mutex
+	static         []string
+	directory      string
+	envPrefix      string
+	commands       []string
+	commandResults map[string][]string
+	refreshing     bool
+	last           []string
+}
+
+func NewCollector(config *cfgfile.SidecarConfig) *Collector {
+	c := &Collector{
+		static:         config.Tags,
+		directory:      config.TagsDirectory,
+		envPrefix:      config.TagsEnvPrefix,
+		commands:       config.TagsCommands,
+		commandResults: make(map[string][]string),
+	}
+	// the first registration already sends the command tags, assignments don't flap after a start
+	c.refreshCommands()
+	return c
+}
+
+// AddStatic adds tags which don't change while the sidecar is running, e.g. inventory tags
+func (c *Collector) AddStatic(tags ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.static = append(append([]string{}, c.static...), tags...)
+}
+
+// Collect returns the current tags, static tags come first followed by the sorted dynamic tags
+func (c *Collector) Collect() []string {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.commands) > 0 && !c.refreshing {
+		c.refreshing = true
+		go c.refreshCommands()
+	}
+
+	var dynamic []string
+	dynamic = append(dynamic, c.fromDirectory()...)
+	dynamic = append(dynamic, c.fromEnvironment()...)
+	for _, command := range c.commands {
+		dynamic = append(dynamic, c.commandResults[command]...)
+	}
+	sort.Strings(dynamic)
+
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range append(append([]string{}, c.static...), dynamic...) {
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if c.last != nil && !reflect.DeepEqual(result, c.last) {
+		log.Infof("Tags changed: %v", result)
+	}
+	c.last = result
+	return result
+}
+
+// every file of the directory contains one tag per line, lines starting with # are ignored
+func (c *Collector) fromDirectory() []string {
+	if c.directory == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(c.directory)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("[Tags] Failed to read tags directory %s: %v", c.directory, err)
+		}
+		return nil
+	}
+	var tags []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(c.directory, entry.Name()))
+		if err != nil {
+			log.Errorf("[Tags] Failed to read tag file: %v", err)
+			continue
+		}
+		tags = append(tags, parseTags(string(content))...)
+	}
+	return tags
+}
+
+// the values of all variables starting with the prefix, a value can hold several tags
+func (c *Collector) fromEnvironment() []string {
+	if c.envPrefix == "" {
+		return nil
+	}
+	var tags []string
+	for _, variable := range os.Environ() {
+		keyValue := strings.SplitN(variable, "=", 2)
+		if len(keyValue) == 2 && strings.HasPrefix(keyValue[0], c.envPrefix) {
+			tags = append(tags, parseTags(keyValue[1])...)
+		}
+	}
+	return tags
+}
+
+// refreshCommands runs all tag commands concurrently, a failing command keeps its previous
+// tags, so assignments don't flap on temporary errors
+func (c *Collector) refreshCommands() {
+	var wg sync.WaitGroup
+	for _, command := range c.commands {
+		wg.Add(1)
+		go func(command string) {
+			defer wg.Done()
+			tags, err := runCommand(command)
+			if err != nil {
+				log.Errorf("[Tags] Tag command %q failed, keeping its previous tags: %v", command, err)
+				return
+			}
+			c.mutex.Lock()
+			c.commandResults[command] = tags
+			c.mutex.Unlock()
+		}(command)
+	}
+	wg.Wait()
+
+	c.mutex.Lock()
+	c.refreshing = false
+	c.mutex.Unlock()
+}
+
+func runCommand(command string) ([]string, error) {
+	args, err := helpers.SplitCommandLine(command)
+	if err != nil || len(args) == 0 {
+		return nil, errors.New("invalid command line")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return parseTags(stdout.String()), nil
+}
+
+// tags are separated by line breaks, commas or white space
+func parseTags(text string) []string {
+	var tags []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		tags = append(tags, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})...)
+	}
+	return tags
+}
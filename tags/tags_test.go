@@ -0,0 +1,121 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package tags
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/cfgfile"
+)
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "role"), []byte("# managed by puppet\nwebserver\nnginx, tls\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SIDECAR_TAG_ZONE", "pci")
+
+	collector := NewCollector(&cfgfile.SidecarConfig{
+		Tags:          []string{"default", "webserver"},
+		TagsDirectory: dir,
+		TagsEnvPrefix: "TEST_SIDECAR_TAG_",
+	})
+	expected := []string{"default", "webserver", "nginx", "pci", "tls"}
+	if result := collector.Collect(); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+
+	// tag files are re-read on every call
+	if err := os.Remove(filepath.Join(dir, "role")); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"default", "webserver", "pci"}
+	if result := collector.Collect(); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestCollectFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "tags.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho database\necho replica\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	collector := NewCollector(&cfgfile.SidecarConfig{TagsCommands: []string{script}})
+	expected := []string{"database", "replica"}
+	if result := collector.Collect(); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+
+	// a failing command keeps its previous tags
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexit 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if result := collector.Collect(); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+}
+
+func waitForCommands(t *testing.T, collector *Collector) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		collector.mutex.Lock()
+		refreshing := collector.refreshing
+		collector.mutex.Unlock()
+		if !refreshing {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("tag commands did not finish")
+}
+
+func TestCollectDoesNotWaitForCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "tags.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho database\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	collector := NewCollector(&cfgfile.SidecarConfig{TagsCommands: []string{script}})
+	collector.Collect()
+	waitForCommands(t, collector)
+
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 1\necho cache\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if result := collector.Collect(); !reflect.DeepEqual(result, []string{"database"}) {
+		t.Fatalf("expected the tags of the last run, got %v", result)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Collect waited %v for the tag command", elapsed)
+	}
+
+	waitForCommands(t, collector)
+	if result := collector.Collect(); !reflect.DeepEqual(result, []string{"cache"}) {
+		t.Fatalf("expected the refreshed tags, got %v", result)
+	}
+}
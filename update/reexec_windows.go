@@ -0,0 +1,25 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package update
+
+import "os"
+
+// reexec exits with an error, the failure actions of the service start the restored executable
+func reexec() error {
+	log.Info("[SelfUpdate] Exiting to let the service recovery start the previous version")
+	os.Exit(1)
+	return nil
+}
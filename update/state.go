@@ -0,0 +1,91 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package update
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// state survives the restart into the new version, it is stored next to the executable
+type state struct {
+	PreviousVersion string    `json:"previous_version,omitempty"`
+	TargetVersion   string    `json:"target_version,omitempty"`
+	Backup          string    `json:"backup,omitempty"`
+	StartedAt       time.Time `json:"started_at,omitempty"`
+	// starts of the new version, counted before the configuration is loaded
+	Attempts int `json:"attempts,omitempty"`
+	// versions which were rolled back are not installed again
+	FailedVersions []string `json:"failed_versions,omitempty"`
+}
+
+func (s *state) pending() bool {
+	return s.TargetVersion != ""
+}
+
+func (s *state) failed(version string) bool {
+	for _, failed := range s.FailedVersions {
+		if failed == version {
+			return true
+		}
+	}
+	return false
+}
+
+// markFailed ends the pending update and remembers its version
+func (s *state) markFailed() {
+	if !s.failed(s.TargetVersion) {
+		s.FailedVersions = append(s.FailedVersions, s.TargetVersion)
+	}
+	s.clear()
+}
+
+func (s *state) clear() {
+	s.PreviousVersion = ""
+	s.TargetVersion = ""
+	s.Backup = ""
+	s.StartedAt = time.Time{}
+	s.Attempts = 0
+}
+
+func readState(path string) (*state, error) {
+	s := &state{}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(content, s)
+}
+
+func writeState(path string, s *state) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package update
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// installExecutable replaces executable with the file at source and keeps the current
+// executable at backup, which must not exist yet. The new file is prepared next to the
+// executable, so the final rename stays on the same filesystem.
+func installExecutable(source string, executable string, backup string) error {
+	// the backup is the only way back, it is never replaced
+	if _, err := os.Lstat(backup); err == nil {
+		return fmt.Errorf("backup %s already exists", backup)
+	}
+	staged := executable + ".new"
+	if err := copyFile(source, staged, 0755); err != nil {
+		os.Remove(staged)
+		return err
+	}
+	if err := swapExecutable(staged, executable, backup); err != nil {
+		os.Remove(staged)
+		return err
+	}
+	return nil
+}
+
+// swapExecutable moves replacement to executable. The current executable is kept at backup.
+func swapExecutable(replacement string, executable string, backup string) error {
+	os.Remove(backup)
+	if err := os.Link(executable, backup); err == nil {
+		// atomic on Unix, the executable is never missing
+		if err := os.Rename(replacement, executable); err == nil {
+			return nil
+		}
+		os.Remove(backup)
+	}
+	// Windows doesn't allow replacing a running executable, but it can be moved
+	if err := os.Rename(executable, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(replacement, executable); err != nil {
+		os.Rename(backup, executable)
+		return err
+	}
+	return nil
+}
+
+func copyFile(source string, destination string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
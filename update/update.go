@@ -0,0 +1,349 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package update
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-version"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+	"github.com/Graylog2/collector-sidecar/common"
+	"github.com/Graylog2/collector-sidecar/context"
+	"github.com/Graylog2/collector-sidecar/download"
+	"github.com/Graylog2/collector-sidecar/logger"
+)
+
+const (
+	maxArtifactSize = 512 << 20
+	// a new version which doesn't get through this many starts is rolled back
+	maxStartAttempts = 3
+)
+
+var log = logger.Log()
+
+// Updater replaces the sidecar binary with the version advertised by the server or the manifest URL.
+// The new version is rolled back if it fails to start maxStartAttempts times or doesn't register
+// with the server within the rollback timeout.
+type Updater struct {
+	mutex           sync.Mutex
+	version         string
+	executable      string
+	downloadPath    string
+	statePath       string
+	publicKey       ed25519.PublicKey
+	manifestUrl     string
+	checkInterval   time.Duration
+	rollbackTimeout time.Duration
+	allowDowngrade  bool
+	restart         func() error
+	rollbackTimer   *time.Timer
+	busy            bool
+}
+
+// the state is stored next to the executable, so it can be checked before the configuration is loaded
+func newUpdater(executable string) *Updater {
+	return &Updater{
+		version:    common.CollectorVersion,
+		executable: executable,
+		statePath:  executable + ".update.json",
+	}
+}
+
+func locateExecutable() (string, error) {
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		return "", fmt.Errorf("can't find the sidecar executable: %v", err)
+	}
+	return executable, nil
+}
+
+// NewUpdater prepares updates of the running executable, restart is called after the binary was replaced
+func NewUpdater(ctx *context.Ctx, restart func() error) (*Updater, error) {
+	config := ctx.UserConfig.SelfUpdate
+	publicKey, err := download.ParsePublicKey(config.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	executable, err := locateExecutable()
+	if err != nil {
+		return nil, err
+	}
+	u := newUpdater(executable)
+	u.downloadPath = filepath.Join(ctx.UserConfig.CachePath, "updates")
+	u.publicKey = publicKey
+	u.manifestUrl = config.ManifestUrl
+	u.checkInterval = config.CheckInterval
+	u.rollbackTimeout = config.RollbackTimeout
+	u.allowDowngrade = config.AllowDowngrade
+	u.restart = restart
+	return u, nil
+}
+
+// RollbackFailedUpdate is called at process start, before the configuration is loaded. Every start of
+// a pending update is counted, a new version that crashes or rejects the configuration is replaced by
+// the previous one before it can fail again.
+func RollbackFailedUpdate() {
+	executable, err := locateExecutable()
+	if err != nil {
+		return
+	}
+	u := newUpdater(executable)
+	u.restart = reexec
+	u.checkStartAttempt()
+}
+
+func (u *Updater) checkStartAttempt() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	s, err := readState(u.statePath)
+	if err != nil {
+		log.Errorf("[SelfUpdate] Can't read update state: %v", err)
+		return
+	}
+	if !s.pending() {
+		return
+	}
+	if u.version != s.TargetVersion {
+		// the new binary was never started or replaced by someone else
+		log.Warnf("[SelfUpdate] Update to %s did not take effect, running %s", s.TargetVersion, u.version)
+		s.markFailed()
+		if err := writeState(u.statePath, s); err != nil {
+			log.Errorf("[SelfUpdate] Can't write update state: %v", err)
+		}
+		return
+	}
+
+	s.Attempts++
+	if s.Attempts > maxStartAttempts {
+		log.Errorf("[SelfUpdate] Version %s failed to start %d times, rolling back to %s",
+			s.TargetVersion, maxStartAttempts, s.PreviousVersion)
+		u.restoreBackup(s)
+		return
+	}
+	if err := writeState(u.statePath, s); err != nil {
+		log.Errorf("[SelfUpdate] Can't write update state: %v", err)
+	}
+}
+
+// Start arms the rollback of a pending update and polls the manifest URL if one is configured
+func (u *Updater) Start(httpClient *http.Client) {
+	u.armRollbackTimer()
+	if u.manifestUrl == "" {
+		return
+	}
+	go func() {
+		for {
+			manifest := &graylog.ResponseUpdateManifest{}
+			if err := download.JSON(httpClient, u.manifestUrl, manifest); err != nil {
+				log.Errorf("[SelfUpdate] Failed to fetch update manifest: %v", err)
+			} else if err := u.Apply(httpClient, manifest); err != nil {
+				log.Errorf("[SelfUpdate] %v", err)
+			}
+			time.Sleep(u.checkInterval)
+		}
+	}()
+}
+
+// a new version which starts but never registers is rolled back after the rollback timeout
+func (u *Updater) armRollbackTimer() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	s, err := readState(u.statePath)
+	if err != nil || !s.pending() || u.version != s.TargetVersion {
+		return
+	}
+	log.Infof("[SelfUpdate] Updated from %s to %s, waiting for the registration with the server",
+		s.PreviousVersion, s.TargetVersion)
+	u.rollbackTimer = time.AfterFunc(u.rollbackTimeout, u.rollback)
+}
+
+// Confirm is called after a successful registration, it completes a pending update
+func (u *Updater) Confirm() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.rollbackTimer == nil {
+		return
+	}
+	if !u.rollbackTimer.Stop() {
+		// the rollback is already running
+		return
+	}
+	u.rollbackTimer = nil
+	s, err := readState(u.statePath)
+	if err != nil || !s.pending() {
+		return
+	}
+	os.Remove(s.Backup)
+	log.Infof("[SelfUpdate] Update to %s completed", s.TargetVersion)
+	s.clear()
+	if err := writeState(u.statePath, s); err != nil {
+		log.Errorf("[SelfUpdate] Can't write update state: %v", err)
+	}
+}
+
+// rollback restores the previous executable if the new version didn't register in time
+func (u *Updater) rollback() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.rollbackTimer = nil
+	s, err := readState(u.statePath)
+	if err != nil || !s.pending() {
+		return
+	}
+	log.Errorf("[SelfUpdate] Version %s did not register within %v, rolling back to %s",
+		s.TargetVersion, u.rollbackTimeout, s.PreviousVersion)
+	u.restoreBackup(s)
+}
+
+// restoreBackup moves the previous executable back in place and restarts it
+func (u *Updater) restoreBackup(s *state) {
+	if err := swapExecutable(s.Backup, u.executable, u.executable+".failed"); err != nil {
+		log.Errorf("[SelfUpdate] Rollback failed: %v", err)
+		return
+	}
+	os.Remove(u.executable + ".failed")
+	s.markFailed()
+	if err := writeState(u.statePath, s); err != nil {
+		log.Errorf("[SelfUpdate] Can't write update state: %v", err)
+	}
+	if err := u.restart(); err != nil {
+		log.Errorf("[SelfUpdate] Failed to restart after rollback: %v", err)
+	}
+}
+
+// Apply installs the advertised version if it differs from the running one and restarts the sidecar.
+// Lower versions are refused unless downgrades are allowed, an old signed release with known bugs
+// can't be pushed to the node.
+func (u *Updater) Apply(httpClient *http.Client, manifest *graylog.ResponseUpdateManifest) error {
+	if manifest == nil || manifest.Version == "" || manifest.Version == u.version {
+		return nil
+	}
+	if !u.allowDowngrade {
+		if err := checkUpgrade(u.version, manifest.Version); err != nil {
+			return err
+		}
+	}
+	u.mutex.Lock()
+	if u.busy || u.rollbackTimer != nil {
+		// an update is running or the current one isn't confirmed yet
+		u.mutex.Unlock()
+		return nil
+	}
+	u.busy = true
+	u.mutex.Unlock()
+	defer func() {
+		u.mutex.Lock()
+		u.busy = false
+		u.mutex.Unlock()
+	}()
+
+	s, err := readState(u.statePath)
+	if err != nil {
+		return fmt.Errorf("can't read update state: %v", err)
+	}
+	if s.pending() {
+		// installed but not running yet, e.g. because the restart failed
+		log.Debugf("[SelfUpdate] Version %s is installed and becomes active after a restart", s.TargetVersion)
+		return nil
+	}
+	if s.failed(manifest.Version) {
+		log.Debugf("[SelfUpdate] Skipping version %s, it was rolled back before", manifest.Version)
+		return nil
+	}
+
+	artifact, err := findArtifact(manifest)
+	if err != nil {
+		return err
+	}
+	if err := download.VerifySignature(u.publicKey, signedMessage(manifest.Version, artifact), artifact.Signature); err != nil {
+		return fmt.Errorf("refusing update to %s: %v", manifest.Version, err)
+	}
+	log.Infof("[SelfUpdate] Updating from %s to %s", u.version, manifest.Version)
+	downloaded := filepath.Join(u.downloadPath, filepath.Base(u.executable)+"-"+manifest.Version)
+	if err := download.File(httpClient, artifact.Url, downloaded, artifact.Sha256, maxArtifactSize); err != nil {
+		return fmt.Errorf("failed to download version %s: %v", manifest.Version, err)
+	}
+	defer os.Remove(downloaded)
+
+	// the state is written first, an interrupted install is detected at the next start
+	s.PreviousVersion = u.version
+	s.TargetVersion = manifest.Version
+	s.Backup = u.executable + ".previous"
+	s.StartedAt = time.Now().UTC()
+	s.Attempts = 0
+	if err := writeState(u.statePath, s); err != nil {
+		return fmt.Errorf("can't write update state: %v", err)
+	}
+	if err := installExecutable(downloaded, u.executable, s.Backup); err != nil {
+		s.clear()
+		writeState(u.statePath, s)
+		return fmt.Errorf("failed to install version %s: %v", manifest.Version, err)
+	}
+	log.Infof("[SelfUpdate] Installed version %s, restarting", manifest.Version)
+	return u.restart()
+}
+
+// checkUpgrade refuses versions lower than the running one, versions which can't be compared are refused as well
+func checkUpgrade(current string, target string) error {
+	currentVersion, err := version.NewVersion(current)
+	if err != nil {
+		return fmt.Errorf("can't compare running version %q: %v", current, err)
+	}
+	targetVersion, err := version.NewVersion(target)
+	if err != nil {
+		return fmt.Errorf("refusing update to invalid version %q: %v", target, err)
+	}
+	if targetVersion.LessThan(currentVersion) {
+		return fmt.Errorf("refusing downgrade from %s to %s, `self_update.allow_downgrade' is disabled", current, target)
+	}
+	return nil
+}
+
+// signedMessage binds the signature to the version and platform, a signed binary can't be
+// advertised under another version
+func signedMessage(version string, artifact *graylog.ResponseUpdateArtifact) []byte {
+	return []byte(strings.Join([]string{
+		version,
+		artifact.Os,
+		artifact.Arch,
+		strings.ToLower(strings.TrimSpace(artifact.Sha256)),
+	}, "|"))
+}
+
+func findArtifact(manifest *graylog.ResponseUpdateManifest) (*graylog.ResponseUpdateArtifact, error) {
+	for i, artifact := range manifest.Artifacts {
+		if artifact.Os == runtime.GOOS && artifact.Arch == runtime.GOARCH {
+			if artifact.Url == "" || artifact.Sha256 == "" || artifact.Signature == "" {
+				return nil, errors.New("update artifact needs url, sha256 and signature")
+			}
+			return &manifest.Artifacts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no update artifact for %s/%s in version %s", runtime.GOOS, runtime.GOARCH, manifest.Version)
+}
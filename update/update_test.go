@@ -0,0 +1,307 @@
+// Copyright (C) 2020 Graylog, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the Server Side Public License, version 1,
+// as published by MongoDB, Inc.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// Server Side Public License for more details.
+//
+// You should have received a copy of the Server Side Public License
+// along with this program. If not, see
+// <http://www.mongodb.com/licensing/server-side-public-license>.
+
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Graylog2/collector-sidecar/api/graylog"
+)
+
+func sign(privateKey ed25519.PrivateKey, manifest *graylog.ResponseUpdateManifest) {
+	artifact := &manifest.Artifacts[0]
+	artifact.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedMessage(manifest.Version, artifact)))
+}
+
+func setupUpdater(t *testing.T, binary []byte) (*Updater, *graylog.ResponseUpdateManifest, ed25519.PrivateKey, *int) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "graylog-sidecar")
+	if err := os.WriteFile(executable, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	restarts := 0
+	u := newUpdater(executable)
+	u.version = "1.0.0"
+	u.downloadPath = filepath.Join(dir, "cache", "updates")
+	u.publicKey = publicKey
+	u.rollbackTimeout = time.Minute
+	u.restart = func() error {
+		restarts++
+		return nil
+	}
+
+	digest := sha256.Sum256(binary)
+	manifest := &graylog.ResponseUpdateManifest{
+		Version: "1.1.0",
+		Artifacts: []graylog.ResponseUpdateArtifact{{
+			Os:     runtime.GOOS,
+			Arch:   runtime.GOARCH,
+			Url:    server.URL,
+			Sha256: hex.EncodeToString(digest[:]),
+		}},
+	}
+	sign(privateKey, manifest)
+	return u, manifest, privateKey, &restarts
+}
+
+func assertContent(t *testing.T, path string, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected {
+		t.Fatalf("expected %s to contain %q, got %q", path, expected, content)
+	}
+}
+
+func TestApplyInstallsSignedUpdate(t *testing.T) {
+	u, manifest, _, restarts := setupUpdater(t, []byte("new"))
+
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if *restarts != 1 {
+		t.Fatalf("expected one restart, got %d", *restarts)
+	}
+	assertContent(t, u.executable, "new")
+	assertContent(t, u.executable+".previous", "old")
+
+	s, err := readState(u.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PreviousVersion != "1.0.0" || s.TargetVersion != "1.1.0" {
+		t.Fatalf("unexpected state %+v", s)
+	}
+}
+
+func TestApplyRejectsBadSignature(t *testing.T) {
+	u, manifest, _, restarts := setupUpdater(t, []byte("new"))
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	sign(otherKey, manifest)
+
+	if err := u.Apply(http.DefaultClient, manifest); err == nil {
+		t.Fatal("expected signature error")
+	}
+	if *restarts != 0 {
+		t.Fatal("unexpected restart")
+	}
+	assertContent(t, u.executable, "old")
+}
+
+func TestApplyRejectsRelabeledVersion(t *testing.T) {
+	u, manifest, _, restarts := setupUpdater(t, []byte("new"))
+	// a validly signed build advertised as another version
+	manifest.Version = "2.0.0"
+
+	if err := u.Apply(http.DefaultClient, manifest); err == nil {
+		t.Fatal("expected signature error")
+	}
+	if *restarts != 0 {
+		t.Fatal("unexpected restart")
+	}
+	assertContent(t, u.executable, "old")
+}
+
+func TestApplyRejectsChecksumMismatch(t *testing.T) {
+	u, manifest, privateKey, restarts := setupUpdater(t, []byte("tampered"))
+	// the signature is valid, but the served binary doesn't match it
+	digest := sha256.Sum256([]byte("new"))
+	manifest.Artifacts[0].Sha256 = hex.EncodeToString(digest[:])
+	sign(privateKey, manifest)
+
+	if err := u.Apply(http.DefaultClient, manifest); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	if *restarts != 0 {
+		t.Fatal("unexpected restart")
+	}
+	assertContent(t, u.executable, "old")
+}
+
+func TestApplySkipsRunningVersion(t *testing.T) {
+	u, manifest, _, restarts := setupUpdater(t, []byte("new"))
+	manifest.Version = u.version
+
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if *restarts != 0 {
+		t.Fatal("unexpected restart")
+	}
+}
+
+func TestApplyRefusesDowngrade(t *testing.T) {
+	u, manifest, privateKey, restarts := setupUpdater(t, []byte("old release"))
+	manifest.Version = "0.9.0"
+	sign(privateKey, manifest)
+
+	if err := u.Apply(http.DefaultClient, manifest); err == nil {
+		t.Fatal("expected downgrade to be refused")
+	}
+	if *restarts != 0 {
+		t.Fatal("unexpected restart")
+	}
+	assertContent(t, u.executable, "old")
+
+	u.allowDowngrade = true
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, u.executable, "old release")
+}
+
+func TestApplyWaitsForPendingUpdate(t *testing.T) {
+	u, manifest, privateKey, _ := setupUpdater(t, []byte("new"))
+	u.restart = func() error { return errors.New("not running as a service") }
+	if err := u.Apply(http.DefaultClient, manifest); err == nil {
+		t.Fatal("expected restart error")
+	}
+
+	// the next manifest check must not install over the pending update
+	manifest.Version = "1.2.0"
+	sign(privateKey, manifest)
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, u.executable+".previous", "old")
+	s, _ := readState(u.statePath)
+	if s.TargetVersion != "1.1.0" {
+		t.Fatalf("unexpected state %+v", s)
+	}
+}
+
+func TestApplyKeepsExistingBackup(t *testing.T) {
+	u, manifest, _, restarts := setupUpdater(t, []byte("new"))
+	os.WriteFile(u.executable+".previous", []byte("older"), 0755)
+
+	if err := u.Apply(http.DefaultClient, manifest); err == nil {
+		t.Fatal("expected error for existing backup")
+	}
+	if *restarts != 0 {
+		t.Fatal("unexpected restart")
+	}
+	assertContent(t, u.executable, "old")
+	assertContent(t, u.executable+".previous", "older")
+	if s, _ := readState(u.statePath); s.pending() {
+		t.Fatalf("unexpected state %+v", s)
+	}
+}
+
+func TestRollbackRestoresPreviousVersion(t *testing.T) {
+	u, manifest, _, restarts := setupUpdater(t, []byte("new"))
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new version starts but never registers
+	u.version = "1.1.0"
+	u.checkStartAttempt()
+	u.armRollbackTimer()
+	if u.rollbackTimer == nil {
+		t.Fatal("expected rollback timer")
+	}
+	u.rollbackTimer.Stop()
+	u.rollback()
+
+	assertContent(t, u.executable, "old")
+	if *restarts != 2 {
+		t.Fatalf("expected restart after rollback, got %d restarts", *restarts)
+	}
+	s, _ := readState(u.statePath)
+	if s.pending() || !s.failed("1.1.0") {
+		t.Fatalf("unexpected state %+v", s)
+	}
+
+	// the failed version is not installed again
+	u.version = "1.0.0"
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if *restarts != 2 {
+		t.Fatal("failed version was installed again")
+	}
+}
+
+func TestRollbackAfterFailedStarts(t *testing.T) {
+	u, manifest, _, restarts := setupUpdater(t, []byte("new"))
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new version exits before it loaded its configuration, Confirm is never reached
+	u.version = "1.1.0"
+	for i := 0; i < maxStartAttempts; i++ {
+		u.checkStartAttempt()
+		assertContent(t, u.executable, "new")
+	}
+	u.checkStartAttempt()
+
+	assertContent(t, u.executable, "old")
+	if *restarts != 2 {
+		t.Fatalf("expected restart after rollback, got %d restarts", *restarts)
+	}
+	s, _ := readState(u.statePath)
+	if s.pending() || !s.failed("1.1.0") {
+		t.Fatalf("unexpected state %+v", s)
+	}
+}
+
+func TestConfirmCompletesUpdate(t *testing.T) {
+	u, manifest, _, _ := setupUpdater(t, []byte("new"))
+	if err := u.Apply(http.DefaultClient, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	u.version = "1.1.0"
+	u.checkStartAttempt()
+	u.armRollbackTimer()
+	u.Confirm()
+
+	if u.rollbackTimer != nil {
+		t.Fatal("rollback timer still armed")
+	}
+	if _, err := os.Stat(u.executable + ".previous"); !os.IsNotExist(err) {
+		t.Fatal("expected backup to be removed")
+	}
+	s, _ := readState(u.statePath)
+	if s.pending() {
+		t.Fatalf("unexpected state %+v", s)
+	}
+	assertContent(t, u.executable, "new")
+}